@@ -0,0 +1,174 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Annotation describes something BOSH did during the recording: a director
+// event such as an instance update or a VM being deleted, or a task stage.
+// When several deployments are recorded it is labelled with its director
+// and deployment.
+type Annotation struct {
+	Director   string `json:"director,omitempty"`
+	Deployment string `json:"deployment,omitempty"`
+	Action     string `json:"action,omitempty"`
+	ObjectType string `json:"object_type,omitempty"`
+	ObjectName string `json:"object_name,omitempty"`
+	Phase      string `json:"phase,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// DeploymentTimes are annotations by the Unix time in milliseconds they
+// happened at.
+type DeploymentTimes map[int64][]Annotation
+
+// EventFilter selects director events by "action/object-type" patterns,
+// e.g. "update/instance" or "*/vm". An empty filter matches everything.
+type EventFilter []string
+
+func (a Annotation) String() string {
+	parts := []string{}
+	for _, part := range []string{a.Action, a.ObjectType, a.ObjectName, a.Phase} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	annotation := strings.Join(parts, " ")
+	if a.Error != "" {
+		annotation += ": " + a.Error
+	}
+	if label := deploymentLabel(a.Director, a.Deployment); label != "" {
+		annotation = label + ": " + annotation
+	}
+	return annotation
+}
+
+func (f EventFilter) Matches(action, objectType string) bool {
+	if len(f) == 0 {
+		return true
+	}
+	for _, pattern := range f {
+		patternParts := strings.SplitN(pattern, "/", 2)
+		if patternParts[0] != "*" && patternParts[0] != action {
+			continue
+		}
+		if len(patternParts) == 1 || patternParts[1] == "*" || patternParts[1] == objectType {
+			return true
+		}
+	}
+	return false
+}
+
+// Timestamps returns the annotated timestamps in order.
+func (d DeploymentTimes) Timestamps() []int64 {
+	timestamps := int64Slice{}
+	for timestamp := range d {
+		timestamps = append(timestamps, timestamp)
+	}
+	sort.Sort(timestamps)
+	return timestamps
+}
+
+type int64Slice []int64
+
+func (s int64Slice) Len() int           { return len(s) }
+func (s int64Slice) Less(i, j int) bool { return s[i] < s[j] }
+func (s int64Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func (d DeploymentTimes) add(timestamp int64, annotation Annotation) {
+	d[timestamp] = append(d[timestamp], annotation)
+}
+
+// unixMillis is the key of t in DeploymentTimes.
+func unixMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// label marks all annotations as belonging to the deployment.
+func (d DeploymentTimes) label(director, deployment string) {
+	for _, annotations := range d {
+		for i := range annotations {
+			annotations[i].Director = director
+			annotations[i].Deployment = deployment
+		}
+	}
+}
+
+type annotationCursor struct {
+	times      DeploymentTimes
+	timestamps []int64
+}
+
+func (d DeploymentTimes) cursor() *annotationCursor {
+	return &annotationCursor{times: d, timestamps: d.Timestamps()}
+}
+
+// upTo returns the annotations of the timestamps up to the given one that
+// haven't been returned before, so that each annotates only the first
+// result at or after it even if several results share a millisecond.
+func (c *annotationCursor) upTo(timestamp int64) []Annotation {
+	annotations := []Annotation{}
+	for len(c.timestamps) > 0 && c.timestamps[0] <= timestamp {
+		annotations = append(annotations, c.times[c.timestamps[0]]...)
+		c.timestamps = c.timestamps[1:]
+	}
+	return annotations
+}
+
+func joinAnnotations(annotations []Annotation) string {
+	annotationStrings := []string{}
+	for _, annotation := range annotations {
+		annotationStrings = append(annotationStrings, annotation.String())
+	}
+	return strings.Join(annotationStrings, "\n")
+}
+
+var annotationText = regexp.MustCompile(`^(?:(\S+): )?(.+?) (start|done|failed)(?:: (.*))?$`)
+
+// parseAnnotation reads an annotation back from the text written to the
+// annotation column of a CSV recording.
+func parseAnnotation(text string) Annotation {
+	match := annotationText.FindStringSubmatch(text)
+	if match == nil {
+		return Annotation{ObjectName: text}
+	}
+	annotation := Annotation{Phase: match[3], Error: match[4]}
+	if slash := strings.LastIndex(match[1], "/"); slash != -1 {
+		annotation.Director, annotation.Deployment = match[1][:slash], match[1][slash+1:]
+	} else {
+		annotation.Deployment = match[1]
+	}
+	words := strings.SplitN(match[2], " ", 3)
+	switch {
+	case words[0] == "stage" || words[0] == "window":
+		annotation.ObjectType = words[0]
+		annotation.ObjectName = strings.TrimPrefix(match[2], words[0]+" ")
+	case len(words) == 3:
+		annotation.Action, annotation.ObjectType, annotation.ObjectName = words[0], words[1], words[2]
+	case len(words) == 1:
+		annotation.ObjectType = words[0]
+	case len(words) == 2:
+		annotation.Action, annotation.ObjectType = words[0], words[1]
+	default:
+		annotation.ObjectName = match[2]
+	}
+	return annotation
+}
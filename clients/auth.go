@@ -0,0 +1,142 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/bosh-cli/uaa"
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+)
+
+const (
+	authRetries = 3
+	// authRetryDelay is how long to wait before retrying a director
+	// request that was rejected for its credentials.
+	authRetryDelay = time.Second
+	// tokenRenewal is how long a UAA token is used before a new one is
+	// requested, so that long recordings don't run into expired tokens.
+	tokenRenewal = 5 * time.Minute
+)
+
+// tokenSession hands out UAA client tokens for director requests. A new
+// token is requested when the director rejected the last one, when it was
+// expired by a failed request or after tokenRenewal. Unlike the bosh CLI's
+// session it is safe to use from several goroutines.
+type tokenSession struct {
+	uaa      tokenGranter
+	now      func() time.Time
+	token    uaa.Token
+	obtained time.Time
+	lock     sync.Mutex
+}
+
+// tokenGranter is the part of the UAA client that tokenSession uses.
+type tokenGranter interface {
+	ClientCredentialsGrant() (uaa.Token, error)
+}
+
+func newTokenSession(uaaClient tokenGranter) *tokenSession {
+	return &tokenSession{uaa: uaaClient, now: time.Now}
+}
+
+func (s *tokenSession) TokenFunc(retried bool) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.token == nil || retried || !s.token.IsValid() || s.now().Sub(s.obtained) > tokenRenewal {
+		token, err := s.uaa.ClientCredentialsGrant()
+		if err != nil {
+			return "", tokenError{err}
+		}
+		s.token = token
+		s.obtained = s.now()
+	}
+	return s.token.Type() + " " + s.token.Value(), nil
+}
+
+// tokenError is returned when UAA didn't grant a token, so that the request
+// that needed it is retried.
+type tokenError struct {
+	err error
+}
+
+func (e tokenError) Error() string {
+	return "getting token: " + e.err.Error()
+}
+
+func (s *tokenSession) expire() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.token = nil
+}
+
+// authenticated runs a director request. If the director rejects the
+// credentials, e.g. because the token expired, the token is renewed and
+// the request retried.
+func (b *BoshImpl) authenticated(request func() error) error {
+	err := request()
+	for attempt := 1; attempt <= authRetries && isAuthError(err); attempt++ {
+		log.Println(fmt.Sprintf("Director rejected the credentials, retrying (%d of %d): %s", attempt, authRetries, err))
+		if b.tokens != nil {
+			b.tokens.expire()
+		}
+		b.sleep(authRetryDelay)
+		err = request()
+	}
+	return err
+}
+
+func (b *BoshImpl) sleep(delay time.Duration) {
+	if b.sleepFunc != nil {
+		b.sleepFunc(delay)
+		return
+	}
+	time.Sleep(delay)
+}
+
+// responseStatus is how the director and UAA clients of the bosh CLI report
+// the status of a failed request, which they don't expose otherwise.
+var responseStatus = regexp.MustCompile(`responded with non-successful status code '(\d+)'`)
+
+// isAuthError tells whether the director or UAA rejected the credentials,
+// or no token could be had. Errors are followed through the wrapping of the
+// bosh CLI and of net/http to their cause.
+func isAuthError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if match := responseStatus.FindStringSubmatch(err.Error()); match != nil && match[1] == "401" {
+		return true
+	}
+	for err != nil {
+		switch cause := err.(type) {
+		case tokenError:
+			return true
+		case bosherr.ComplexError:
+			err = cause.Cause
+		case *url.Error:
+			err = cause.Err
+		default:
+			return false
+		}
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients_test
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/cloudfoundry/bosh-cli/uaa"
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	"github.com/pivotal-cf/downtimer/clients"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeToken struct {
+	value string
+	valid bool
+}
+
+func (t fakeToken) Type() string  { return "bearer" }
+func (t fakeToken) Value() string { return t.value }
+func (t fakeToken) IsValid() bool { return t.valid }
+
+type fakeUAA struct {
+	grants int
+	valid  bool
+	err    error
+}
+
+func (u *fakeUAA) ClientCredentialsGrant() (uaa.Token, error) {
+	if u.err != nil {
+		return nil, u.err
+	}
+	u.grants++
+	return fakeToken{value: fmt.Sprintf("token-%d", u.grants), valid: u.valid}, nil
+}
+
+var _ = Describe("UAA tokens", func() {
+	var uaaClient *fakeUAA
+	var now time.Time
+	var tokens func(retried bool) (string, error)
+
+	BeforeEach(func() {
+		uaaClient = &fakeUAA{valid: true}
+		now = time.Date(2017, 8, 1, 10, 0, 0, 0, time.UTC)
+		tokens = clients.NewTestTokenSession(uaaClient, func() time.Time { return now }).TokenFunc
+	})
+
+	It("reuses a token until it is five minutes old", func() {
+		Expect(tokens(false)).To(Equal("bearer token-1"))
+		now = now.Add(5 * time.Minute)
+		Expect(tokens(false)).To(Equal("bearer token-1"))
+		now = now.Add(time.Second)
+		Expect(tokens(false)).To(Equal("bearer token-2"))
+	})
+
+	It("renews a token that is no longer valid", func() {
+		uaaClient.valid = false
+		Expect(tokens(false)).To(Equal("bearer token-1"))
+		Expect(tokens(false)).To(Equal("bearer token-2"))
+	})
+
+	It("renews the token when a request is retried", func() {
+		Expect(tokens(false)).To(Equal("bearer token-1"))
+		Expect(tokens(true)).To(Equal("bearer token-2"))
+	})
+})
+
+var _ = Describe("Authenticated director requests", func() {
+	var uaaClient *fakeUAA
+	var sleeps []time.Duration
+	var bosh *clients.BoshImpl
+
+	BeforeEach(func() {
+		uaaClient = &fakeUAA{valid: true}
+		sleeps = nil
+		session := clients.NewTestTokenSession(uaaClient, time.Now)
+		bosh = clients.NewTestBosh(session, func(delay time.Duration) { sleeps = append(sleeps, delay) })
+	})
+
+	It("retries a rejected request three times with a new token", func() {
+		requests := 0
+		err := bosh.Authenticated(func() error {
+			requests++
+			return errors.New("Director responded with non-successful status code '401' response 'Not authorized'")
+		})
+		Expect(err).To(MatchError(ContainSubstring("'401'")))
+		Expect(requests).To(Equal(4))
+		Expect(sleeps).To(Equal([]time.Duration{time.Second, time.Second, time.Second}))
+	})
+
+	It("stops retrying once the request succeeds", func() {
+		requests := 0
+		err := bosh.Authenticated(func() error {
+			requests++
+			if requests == 1 {
+				return errors.New("UAA responded with non-successful status code '401' response 'invalid_token'")
+			}
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(requests).To(Equal(2))
+		Expect(sleeps).To(HaveLen(1))
+	})
+
+	It("retries when no token could be had, however the error was wrapped", func() {
+		uaaClient.err = errors.New("dial tcp 10.0.0.6:8443: connect: connection refused")
+		session := clients.NewTestTokenSession(uaaClient, time.Now)
+		requests := 0
+		err := bosh.Authenticated(func() error {
+			requests++
+			_, err := session.TokenFunc(false)
+			return bosherr.WrapError(&url.Error{Op: "Get", URL: "https://10.0.0.6:25555/tasks", Err: err}, "Performing request GET")
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(requests).To(Equal(4))
+	})
+
+	It("doesn't retry other errors", func() {
+		requests := 0
+		err := bosh.Authenticated(func() error {
+			requests++
+			return errors.New("Director responded with non-successful status code '404' response 'Task 401 not found'")
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(requests).To(Equal(1))
+		Expect(sleeps).To(BeEmpty())
+	})
+})
@@ -16,10 +16,9 @@ limitations under the License. */
 package clients
 
 import (
-	"io/ioutil"
-	"log"
+	"bytes"
 	"os"
-	"strings"
+	"strconv"
 	"time"
 
 	"github.com/cloudfoundry/bosh-cli/director"
@@ -29,83 +28,164 @@ import (
 )
 
 type Bosh interface {
-	GetDeploymentTimes(taskID string) DeploymentTimes
-	GetCurrentTaskId() (int, error)
-	WaitForTaskId(timeout time.Duration) int
+	GetDeploymentTimes(taskID string, filter EventFilter, since time.Time) (DeploymentTimes, error)
+	GetTaskStages(taskID string) ([]Stage, error)
+	GetCurrentTasks() ([]Task, error)
+	GetTaskState(taskID string) (string, error)
+}
+
+type Task struct {
+	ID          int
+	Deployment  string
+	Description string
+	State       string
+	StartedAt   time.Time
 }
 
 type BoshImpl struct {
 	director director.Director
+	tokens   *tokenSession
+	// sleepFunc waits before retrying a request, time.Sleep if nil.
+	sleepFunc func(time.Duration)
 }
 
-func (b *BoshImpl) GetDeploymentTimes(taskID string) DeploymentTimes {
+// GetDeploymentTimes returns the events of the task. With a non-zero since
+// only the ones from the second of since on are fetched, so that following
+// a long task doesn't download all of its events again.
+func (b *BoshImpl) GetDeploymentTimes(taskID string, filter EventFilter, since time.Time) (DeploymentTimes, error) {
 	eventsFilter := director.EventsFilter{Task: taskID}
-	events, err := b.director.Events(eventsFilter)
+	if !since.IsZero() {
+		// The director lists the events after the given second.
+		eventsFilter.After = strconv.FormatInt(since.Unix()-1, 10)
+	}
+	var events []director.Event
+	err := b.authenticated(func() error {
+		var err error
+		events, err = b.director.Events(eventsFilter)
+		return err
+	})
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	timestamps := DeploymentTimes{}
 	for _, event := range events {
-		if event.Action() == "update" && event.ObjectType() == "instance" {
-			eventTime := event.Timestamp().Unix()
-			_, ok := timestamps[eventTime]
-			if !ok {
-				timestamps[eventTime] = []string{}
-			}
-			// Event with empty context is the end time.
-			instanceParts := strings.Split(event.Instance(), "/")
-			instanceName := instanceParts[0]
-			if len(event.Context()) == 0 {
-				timestamps[eventTime] = append(timestamps[eventTime], instanceName+" done")
-			} else {
-				timestamps[eventTime] = append(timestamps[eventTime], instanceName+" start")
-			}
+		if !filter.Matches(event.Action(), event.ObjectType()) || event.Timestamp().Before(since.Truncate(time.Second)) {
+			continue
 		}
+		timestamps.add(unixMillis(event.Timestamp()), eventAnnotation(event))
 	}
-	return timestamps
+	return timestamps, nil
 }
 
-func (b *BoshImpl) GetCurrentTaskId() (int, error) {
-	currentTasks, err := b.director.CurrentTasks(director.TasksFilter{})
+func (b *BoshImpl) GetTaskStages(taskID string) ([]Stage, error) {
+	id, err := strconv.Atoi(taskID)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	var currentTaskId int
-	for _, task := range currentTasks {
-		if task.Description() == "create deployment" {
-			currentTaskId = task.ID()
-			break
+	reporter := &taskEventReporter{}
+	err = b.authenticated(func() error {
+		task, err := b.director.FindTask(id)
+		if err != nil {
+			return err
 		}
+		reporter.output.Reset()
+		return task.EventOutput(reporter)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ParseTaskEvents(reporter.output.Bytes())
+}
+
+func (b *BoshImpl) GetCurrentTasks() ([]Task, error) {
+	var currentTasks []director.Task
+	err := b.authenticated(func() error {
+		var err error
+		currentTasks, err = b.director.CurrentTasks(director.TasksFilter{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	tasks := []Task{}
+	for _, task := range currentTasks {
+		tasks = append(tasks, Task{
+			ID:          task.ID(),
+			Deployment:  task.DeploymentName(),
+			Description: task.Description(),
+			State:       task.State(),
+			StartedAt:   task.StartedAt(),
+		})
+	}
+	return tasks, nil
+}
+
+func (b *BoshImpl) GetTaskState(taskID string) (string, error) {
+	id, err := strconv.Atoi(taskID)
+	if err != nil {
+		return "", err
+	}
+	var task director.Task
+	err = b.authenticated(func() error {
+		var err error
+		task, err = b.director.FindTask(id)
+		return err
+	})
+	if err != nil {
+		return "", err
 	}
-	return currentTaskId, nil
+	return task.State(), nil
 }
 
 func (b *BoshImpl) IsAuthenticated() (bool, error) {
 	return b.director.IsAuthenticated()
 }
 
-func (b *BoshImpl) WaitForTaskId(timeout time.Duration) int {
-	timeoutChannel := time.After(timeout)
-	tick := time.Tick(5 * time.Second)
-
-	for {
-		select {
-		case <-timeoutChannel:
-			log.Println("Bailed on getting the Task ID")
-			return 0
-		case <-tick:
-			log.Println("Pulling Bosh for Deployment Task")
-			id, err := b.GetCurrentTaskId()
-			if err != nil {
-				log.Println(err)
-			}
-
-			if id != 0 {
-				return id
-			}
+func (t Task) IsDeploy() bool {
+	return t.Description == "create deployment"
+}
+
+// TaskFailed reports whether a finished task failed, was cancelled or
+// timed out.
+func TaskFailed(state string) bool {
+	return state == "error" || state == "cancelled" || state == "timeout"
+}
+
+func runningTask(tasks []Task, id int) (Task, bool) {
+	for _, task := range tasks {
+		if task.ID == id {
+			return task, true
 		}
 	}
+	return Task{}, false
+}
+
+// eventAnnotation describes a director event. Every operation is recorded as
+// a pair of events, the one closing it refers to the opening one as parent.
+func eventAnnotation(event director.Event) Annotation {
+	phase := "start"
+	if event.ParentID() != "" {
+		phase = "done"
+	}
+	return Annotation{
+		Action:     event.Action(),
+		ObjectType: event.ObjectType(),
+		ObjectName: event.ObjectName(),
+		Phase:      phase,
+		Error:      event.Error(),
+	}
+}
+
+// taskEventReporter collects the raw event output of a task.
+type taskEventReporter struct {
+	output bytes.Buffer
+}
+
+func (r *taskEventReporter) TaskStarted(int)          {}
+func (r *taskEventReporter) TaskFinished(int, string) {}
+func (r *taskEventReporter) TaskOutputChunk(_ int, chunk []byte) {
+	r.output.Write(chunk)
 }
 
 func anonymousUserConfig(host string, port int, CACert string) director.Config {
@@ -123,20 +203,20 @@ func userConfig(host string, port int, CACert, username, password string) direct
 	return config
 }
 
-func GetDirector(host string, port int, username, password, caCertFile, logFile string) (*BoshImpl, error) {
+func GetDirector(host string, port int, username, password, caCert, logFile string) (*BoshImpl, error) {
 	log, err := os.Create(logFile)
 	if err != nil {
 		return nil, err
 	}
 	logger := logger.NewWriterLogger(0, log, log)
-	caCertBytes, err := ioutil.ReadFile(caCertFile)
+	caCertPEM, err := readCACert(caCert)
 	if err != nil {
 		return nil, err
 	}
 	config := uaa.Config{
 		Host:         host,
 		Port:         port,
-		CACert:       string(caCertBytes),
+		CACert:       caCertPEM,
 		Client:       username,
 		ClientSecret: password,
 	}
@@ -147,6 +227,7 @@ func GetDirector(host string, port int, username, password, caCertFile, logFile
 	}
 
 	dirConfig := userConfig(config.Host, config.Port, config.CACert, config.Client, config.ClientSecret)
+	var tokens *tokenSession
 
 	if info.Auth.Type == "uaa" {
 		uaaClient, err := getUaa(info, config.Client, config.ClientSecret, config.CACert, logger)
@@ -157,14 +238,15 @@ func GetDirector(host string, port int, username, password, caCertFile, logFile
 		dirConfig.Client = ""
 		dirConfig.ClientSecret = ""
 
-		dirConfig.TokenFunc = uaa.NewClientTokenSession(uaaClient).TokenFunc
+		tokens = newTokenSession(uaaClient)
+		dirConfig.TokenFunc = tokens.TokenFunc
 	}
 
 	taskReporter := director.NewNoopTaskReporter()
 	fileReporter := director.NewNoopFileReporter()
 
 	director, err := director.NewFactory(logger).New(dirConfig, taskReporter, fileReporter)
-	return &BoshImpl{director}, err
+	return &BoshImpl{director: director, tokens: tokens}, err
 }
 
 func getUaa(info director.Info, client, clientSecret, CACert string, logger logger.Logger) (uaa.UAA, error) {
@@ -0,0 +1,136 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const defaultBoshPort = 25555
+
+type boshConfig struct {
+	Environments []boshConfigEnvironment `yaml:"environments"`
+}
+
+type boshConfigEnvironment struct {
+	URL      string `yaml:"url"`
+	Alias    string `yaml:"alias"`
+	CACert   string `yaml:"ca_cert"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// ResolveBoshOpts completes the bosh options the way the bosh CLI does: the
+// director may be given as an alias from the bosh CLI config, which then
+// also provides the CA cert and, for basic auth, the credentials. Options
+// already set take precedence. A missing config file is not an error.
+func ResolveBoshOpts(opts *Opts, configPath string) error {
+	if opts.BoshHost == "" {
+		return nil
+	}
+
+	configFile, err := FS.Open(configPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer configFile.Close()
+	configBytes, err := ioutil.ReadAll(configFile)
+	if err != nil {
+		return err
+	}
+	config := boshConfig{}
+	if err := yaml.Unmarshal(configBytes, &config); err != nil {
+		return err
+	}
+
+	for _, environment := range config.Environments {
+		if environment.Alias != opts.BoshHost && environment.URL != opts.BoshHost {
+			continue
+		}
+		opts.BoshHost = environment.URL
+		if opts.BoshCACert == "" {
+			opts.BoshCACert = environment.CACert
+		}
+		if opts.BoshUser == "" && opts.BoshPassword == "" {
+			opts.BoshUser = environment.Username
+			opts.BoshPassword = environment.Password
+		}
+		break
+	}
+	return nil
+}
+
+// DirectorOpts returns the bosh options for another director, given as an
+// alias or URL. Its CA cert and credentials must come from the bosh CLI
+// config; those of opts are for their own director only.
+func DirectorOpts(opts Opts, director, configPath string) (Opts, error) {
+	directorOpts := opts
+	directorOpts.BoshHost = director
+	directorOpts.BoshCACert = ""
+	directorOpts.BoshUser = ""
+	directorOpts.BoshPassword = ""
+	if err := ResolveBoshOpts(&directorOpts, configPath); err != nil {
+		return opts, err
+	}
+	if directorOpts.BoshCACert == "" || directorOpts.BoshUser == "" || directorOpts.BoshPassword == "" {
+		return opts, fmt.Errorf("the bosh CLI config %s has no CA cert and credentials for director %s", configPath, director)
+	}
+	return directorOpts, nil
+}
+
+// SplitBoshHost accepts the director as a URL, host:port or plain host.
+func SplitBoshHost(director string) (string, int, error) {
+	if strings.Contains(director, "://") {
+		directorURL, err := url.Parse(director)
+		if err != nil {
+			return "", 0, err
+		}
+		director = directorURL.Host
+	}
+
+	host, port, err := net.SplitHostPort(director)
+	if err != nil {
+		return director, defaultBoshPort, nil
+	}
+	portNumber, err := strconv.Atoi(port)
+	if err != nil {
+		return "", 0, err
+	}
+	return host, portNumber, nil
+}
+
+// readCACert accepts the CA cert inline as PEM or as a path to a file.
+func readCACert(caCert string) (string, error) {
+	if strings.Contains(caCert, "-----BEGIN") {
+		return caCert, nil
+	}
+	caCertBytes, err := ioutil.ReadFile(caCert)
+	if err != nil {
+		return "", err
+	}
+	return string(caCertBytes), nil
+}
@@ -17,11 +17,16 @@ package clients_test
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/pivotal-cf/downtimer/clients"
@@ -40,6 +45,22 @@ const sampleRecordFile = `timestamp,success,latency,code,size,fill,annotation
 131415,1,3.568ms,200,79,
 `
 
+const sampleRecordFileV2 = `version,timestamp_ms,success,latency_ms,code,size,error,annotation
+2,123000,1,125.759,200,79,,
+2,123500,0,0.000,0,0,connection refused,
+2,456000,1,2.861,200,79,,
+2,789000,1,2.564,200,79,,
+2,131415000,1,3.568,200,79,,
+`
+
+const sampleRecordFileV3 = `version,timestamp_ms,success,latency_ms,code,size,error,error_class,annotation
+3,123000,1,125.759,200,79,,,
+3,123500,0,0.000,0,0,connection refused,connect_refused,
+3,456000,0,2.861,502,79,,http_5xx,
+3,789000,1,2.564,200,79,,,
+3,131415000,1,3.568,200,79,,,
+`
+
 var mockServer *httptest.Server
 var mockTLSServer *httptest.Server
 var _ = BeforeSuite(func() {
@@ -112,6 +133,40 @@ var _ = Describe("Clients", func() {
 					result := prober.Probe()
 					Expect(result.StatusCode).To(Equal(0))
 					Expect(result.Success).To(Equal(0))
+					Expect(result.ErrorClass).To(Equal(clients.ErrorClassOther))
+				})
+			})
+			Context("when nothing listens on the port", func() {
+				BeforeEach(func() {
+					listener, err := net.Listen("tcp", "127.0.0.1:0")
+					Expect(err).NotTo(HaveOccurred())
+					opts.URL = "http://" + listener.Addr().String()
+					listener.Close()
+				})
+				It("classifies the error as a refused connection", func() {
+					result := prober.Probe()
+					Expect(result.Success).To(Equal(0))
+					Expect(result.ErrorClass).To(Equal(clients.ErrorClassConnectRefused))
+				})
+			})
+			Context("when the host doesn't resolve", func() {
+				BeforeEach(func() {
+					opts.URL = "http://downtimer.invalid"
+				})
+				It("classifies the error as DNS", func() {
+					result := prober.Probe()
+					Expect(result.Success).To(Equal(0))
+					Expect(result.ErrorClass).To(Equal(clients.ErrorClassDNS))
+				})
+			})
+			Context("when the certificate isn't trusted", func() {
+				BeforeEach(func() {
+					opts.URL = mockTLSServer.URL + "/health"
+				})
+				It("classifies the error as TLS", func() {
+					result := prober.Probe()
+					Expect(result.Success).To(Equal(0))
+					Expect(result.ErrorClass).To(Equal(clients.ErrorClassTLS))
 				})
 			})
 			Context("when the URL responds with HTTP 404", func() {
@@ -122,6 +177,7 @@ var _ = Describe("Clients", func() {
 					result := prober.Probe()
 					Expect(result.StatusCode).To(Equal(404))
 					Expect(result.Success).To(Equal(0))
+					Expect(result.ErrorClass).To(Equal(clients.ErrorClassHTTP4xx))
 				})
 			})
 			Context("when the URL responds with HTTP 503", func() {
@@ -132,6 +188,35 @@ var _ = Describe("Clients", func() {
 					result := prober.Probe()
 					Expect(result.StatusCode).To(Equal(503))
 					Expect(result.Success).To(Equal(0))
+					Expect(result.ErrorClass).To(Equal(clients.ErrorClassHTTP5xx))
+				})
+				It("returns status 1 if 503 is expected", func() {
+					opts.ExpectStatus = []int{200, 503}
+					result := clients.NewProber(&opts, bosh).Probe()
+					Expect(result.Success).To(Equal(1))
+				})
+			})
+			Context("when the response body is checked", func() {
+				It("returns status 0 and an error if the body doesn't match", func() {
+					opts.ExpectBody = "^I'm dead"
+					result := clients.NewProber(&opts, bosh).Probe()
+					Expect(result.StatusCode).To(Equal(200))
+					Expect(result.Success).To(Equal(0))
+					Expect(result.Error).To(MatchError(`response body does not match "^I'm dead"`))
+					Expect(result.ErrorClass).To(Equal(clients.ErrorClassBodyMismatch))
+				})
+				It("fails instead of panicking if the expected body doesn't compile", func() {
+					opts.ExpectBody = "(alive"
+					prober := clients.NewProber(&opts, bosh)
+					result := prober.Probe()
+					Expect(result.Success).To(Equal(0))
+					Expect(result.Error).To(MatchError(ContainSubstring("invalid expected body")))
+					Expect(prober.RecordDowntime()).To(MatchError(ContainSubstring("invalid expected body")))
+				})
+				It("returns status 1 if the body matches", func() {
+					opts.ExpectBody = "alive"
+					result := clients.NewProber(&opts, bosh).Probe()
+					Expect(result.Success).To(Equal(1))
 				})
 			})
 		})
@@ -152,41 +237,167 @@ var _ = Describe("Clients", func() {
 					Expect(lineCount).To(Equal(2 + 1)) // +1 for header
 				})
 			})
+			Context("appending to an interrupted recording", func() {
+				BeforeEach(func() {
+					opts.Duration = 10*time.Millisecond + 2*time.Millisecond
+					opts.Interval = 5 * time.Millisecond
+					opts.BoshTask = ""
+					opts.OutputFile = "/output.csv"
+					opts.Append = true
+				})
+				AfterEach(func() {
+					opts.Append = false
+				})
+				It("keeps the results and marks the gap", func() {
+					Expect(afero.WriteFile(clients.FS, opts.OutputFile, []byte(sampleRecordFileV3), 0644)).To(Succeed())
+					Expect(prober.RecordDowntime()).To(Succeed())
+					results, err := clients.ReadResults(opts.OutputFile)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(results).To(HaveLen(5 + 2))
+					Expect(results[0].Timestamp.Unix()).To(Equal(int64(123)))
+
+					windows := prober.Windows()
+					Expect(windows.Start.Unix()).To(Equal(int64(123)))
+					Expect(windows.Gaps).To(HaveLen(1))
+					Expect(windows.Gaps[0].Start.Unix()).To(Equal(int64(131415)))
+					Expect(windows.Gaps[0].End.Unix()).To(Equal(results[5].Timestamp.Unix()))
+					contents, err := afero.ReadFile(clients.FS, opts.OutputFile)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(contents)).To(ContainSubstring("window not recording done"))
+				})
+				It("starts a new recording if there is none", func() {
+					Expect(prober.RecordDowntime()).To(Succeed())
+					results, err := clients.ReadResults(opts.OutputFile)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(results).To(HaveLen(2))
+					Expect(prober.Windows().Gaps).To(BeEmpty())
+				})
+				It("takes the start of the deployment from its task", func() {
+					Expect(afero.WriteFile(clients.FS, opts.OutputFile, []byte(sampleRecordFileV3), 0644)).To(Succeed())
+					opts.BoshTask = "111"
+					opts.BoshPollInterval = time.Millisecond
+					bosh.GetCurrentTasksReturns([]clients.Task{{ID: 111, Description: "create deployment", StartedAt: time.Unix(456, 0)}}, nil)
+					prober = clients.NewProber(&opts, bosh)
+					Expect(prober.RecordDowntime()).To(Succeed())
+					windows := prober.Windows()
+					Expect(windows.Start.Unix()).To(Equal(int64(123)))
+					Expect(windows.DeployStart).To(BeTemporally("==", time.Unix(456, 0)))
+				})
+				It("appends to a recording in layout version 2 in its own layout", func() {
+					Expect(afero.WriteFile(clients.FS, opts.OutputFile, []byte(sampleRecordFileV2), 0644)).To(Succeed())
+					Expect(prober.RecordDowntime()).To(Succeed())
+					results, err := clients.ReadResults(opts.OutputFile)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(results).To(HaveLen(5 + 2))
+
+					contents, err := afero.ReadFile(clients.FS, opts.OutputFile)
+					Expect(err).NotTo(HaveOccurred())
+					lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+					Expect(lines[0]).To(Equal("version,timestamp_ms,success,latency_ms,code,size,error,annotation"))
+					for _, line := range lines[len(lines)-2:] {
+						Expect(line).To(HavePrefix("2,"))
+					}
+					Expect(string(contents)).NotTo(ContainSubstring("\n3,"))
+				})
+				It("refuses to append to a recording with timestamps in seconds", func() {
+					Expect(afero.WriteFile(clients.FS, opts.OutputFile, []byte(sampleRecordFile), 0644)).To(Succeed())
+					err := prober.RecordDowntime()
+					Expect(err).To(MatchError(ContainSubstring("recorded in CSV layout version 1, can only append to version 2 or later")))
+				})
+				It("refuses to append to a file that isn't a recording", func() {
+					Expect(afero.WriteFile(clients.FS, opts.OutputFile, []byte("name,value\nfoo,bar\n"), 0644)).To(Succeed())
+					err := prober.RecordDowntime()
+					Expect(err).To(MatchError(ContainSubstring("cannot append to /output.csv: unexpected header")))
+				})
+			})
+			Context("in the JSON Lines format", func() {
+				BeforeEach(func() {
+					opts.Duration = 10*time.Millisecond + 2*time.Millisecond
+					opts.Interval = 5 * time.Millisecond
+					opts.BoshTask = ""
+					opts.URL = mockServer.URL + "/health"
+					opts.OutputFile = "/output.jsonl"
+					opts.Format = clients.FormatJSONL
+				})
+				AfterEach(func() {
+					opts.Format = ""
+				})
+				It("writes a typed object per result", func() {
+					Expect(prober.RecordDowntime()).To(Succeed())
+					contents, err := afero.ReadFile(clients.FS, opts.OutputFile)
+					Expect(err).NotTo(HaveOccurred())
+					lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+					Expect(lines).To(HaveLen(2))
+
+					var result map[string]interface{}
+					Expect(json.Unmarshal([]byte(lines[0]), &result)).To(Succeed())
+					Expect(result["target"]).To(Equal(opts.URL))
+					Expect(result["success"]).To(BeTrue())
+					Expect(result["status_code"]).To(BeNumerically("==", 200))
+					Expect(result["latency_ms"]).To(BeNumerically(">", 0))
+					_, err = time.Parse(time.RFC3339Nano, result["timestamp"].(string))
+					Expect(err).NotTo(HaveOccurred())
+
+					results, err := clients.ReadResults(opts.OutputFile)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(results).To(HaveLen(2))
+					Expect(results[0].Success).To(Equal(1))
+				})
+				It("annotates the results", func() {
+					Expect(prober.RecordDowntime()).To(Succeed())
+					results, err := clients.ReadResults(opts.OutputFile)
+					Expect(err).NotTo(HaveOccurred())
+					timestamps := clients.DeploymentTimes{
+						results[0].Timestamp.UnixNano() / int64(time.Millisecond): {{Action: "update", ObjectType: "instance", ObjectName: "diego/1", Phase: "start"}},
+					}
+					Expect(prober.AnnotateWithTimestamps(timestamps)).To(Succeed())
+
+					contents, err := afero.ReadFile(clients.FS, opts.OutputFile)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(contents)).To(ContainSubstring(`"annotations":[{"action":"update","object_type":"instance","object_name":"diego/1","phase":"start"}]`))
+				})
+				It("refuses to append to a CSV recording", func() {
+					opts.Append = true
+					defer func() { opts.Append = false }()
+					Expect(afero.WriteFile(clients.FS, opts.OutputFile, []byte(sampleRecordFile), 0644)).To(Succeed())
+					Expect(prober.RecordDowntime()).To(MatchError(ContainSubstring("not a JSON Lines recording")))
+				})
+			})
 			Context("recording downtime for running deployment", func() {
 				Context("when deployment isn't running anymore", func() {
 					JustBeforeEach(func() {
 						opts.Duration = 0 * time.Second
 						opts.Interval = 5 * time.Millisecond
+						opts.BoshPollInterval = opts.Interval
 						opts.BoshTask = "111"
 
-						bosh.GetCurrentTaskIdStub = func() (int, error) {
-							return 0, nil
+						bosh.GetCurrentTasksStub = func() ([]clients.Task, error) {
+							return []clients.Task{}, nil
 						}
 
 					})
 					It("should not record anything ", func() {
-						buf := make([]byte, 32*1024)
 						prober.RecordDowntime()
-						outputFile, err := clients.FS.Open(opts.OutputFile)
+						results, err := clients.ReadResults(opts.OutputFile)
 						Expect(err).NotTo(HaveOccurred())
-						_, err = outputFile.Read(buf)
-						Expect(err).To(MatchError("EOF"))
+						Expect(results).To(BeEmpty())
 					})
 				})
 				Context("when deployment is ongoing", func() {
 					BeforeEach(func() {
 						opts.Duration = 0 * time.Second
 						opts.Interval = 100 * time.Millisecond
+						opts.BoshPollInterval = opts.Interval
 						opts.BoshTask = "111"
 
 						validTaskCount := 4
 
-						bosh.GetCurrentTaskIdStub = func() (int, error) {
+						bosh.GetCurrentTasksStub = func() ([]clients.Task, error) {
 							if validTaskCount > 0 {
 								validTaskCount -= 1
-								return 111, nil
+								return []clients.Task{{ID: 111, Description: "create deployment"}}, nil
 							}
-							return 0, nil
+							return []clients.Task{}, nil
 						}
 
 					})
@@ -198,7 +409,242 @@ var _ = Describe("Clients", func() {
 						readBytesCount, err := outputFile.Read(buf)
 						Expect(err).NotTo(HaveOccurred())
 						lineCount := bytes.Count(buf[:readBytesCount], []byte{'\n'})
-						Expect(lineCount).To(Equal(4 + 1)) // +1 for header
+						// +1 for header. Polls are paced from when the last one
+						// finished, so a slow one can let the prober tick once more.
+						Expect(lineCount).To(BeNumerically(">=", 4+1))
+						Expect(lineCount).To(BeNumerically("<=", 5+1))
+					})
+				})
+				Context("when the director rejects requests for a while", func() {
+					BeforeEach(func() {
+						opts.Duration = 0 * time.Second
+						opts.Interval = 20 * time.Millisecond
+						opts.BoshPollInterval = opts.Interval
+						opts.BoshPollMaxBackoff = opts.Interval
+						opts.BoshTask = "111"
+
+						calls := 0
+						bosh.GetCurrentTasksStub = func() ([]clients.Task, error) {
+							calls++
+							if calls <= 3 {
+								return nil, errors.New("Director responded with non-successful status code '401'")
+							}
+							if calls <= 5 {
+								return []clients.Task{{ID: 111, Description: "create deployment"}}, nil
+							}
+							return []clients.Task{}, nil
+						}
+					})
+					AfterEach(func() {
+						opts.BoshPollMaxBackoff = 0
+					})
+					It("keeps recording until the task ended", func() {
+						prober.RecordDowntime()
+						Expect(bosh.GetCurrentTasksCallCount()).To(Equal(6))
+						results, err := clients.ReadResults(opts.OutputFile)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(len(results)).To(BeNumerically(">=", 4))
+					})
+				})
+				Context("when the deployment fails", func() {
+					BeforeEach(func() {
+						opts.Duration = 0 * time.Second
+						opts.Interval = 20 * time.Millisecond
+						opts.BoshPollInterval = opts.Interval
+						opts.BoshTask = "111"
+						opts.FailureGracePeriod = 200 * time.Millisecond
+
+						bosh.GetCurrentTasksReturns([]clients.Task{}, nil)
+						bosh.GetTaskStateReturns("error", nil)
+					})
+					AfterEach(func() {
+						opts.FailureGracePeriod = 0
+					})
+					It("keeps probing for the grace period", func() {
+						prober.RecordDowntime()
+						Expect(bosh.GetTaskStateArgsForCall(0)).To(Equal("111"))
+
+						outputFile, err := clients.FS.Open(opts.OutputFile)
+						Expect(err).NotTo(HaveOccurred())
+						output, err := ioutil.ReadAll(outputFile)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(bytes.Count(output, []byte{'\n'})).To(BeNumerically(">=", 5))
+					})
+					It("records the task state in the metadata and summary", func() {
+						prober.RecordDowntime()
+						summary, err := prober.AnnotateDeployment()
+						Expect(err).NotTo(HaveOccurred())
+						Expect(summary.TaskFailed()).To(BeTrue())
+						Expect(summary.String()).To(ContainSubstring("Task 111 finished in state error"))
+
+						metadata, err := clients.ReadMetadata(opts.OutputFile)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(metadata.Tasks).To(Equal([]clients.TaskResult{{TaskID: "111", State: "error"}}))
+					})
+				})
+				Context("with a baseline and a tail", func() {
+					BeforeEach(func() {
+						opts.Duration = 0 * time.Second
+						opts.Interval = 10 * time.Millisecond
+						opts.BoshPollInterval = opts.Interval
+						opts.BoshTask = ""
+						opts.Baseline = 50 * time.Millisecond
+						opts.Tail = 100 * time.Millisecond
+
+						// The task shows up after a while and runs for a few
+						// polls, however slow they are.
+						deploymentStart := time.Now().Add(200 * time.Millisecond)
+						var lock sync.Mutex
+						running := 0
+						bosh.GetCurrentTasksStub = func() ([]clients.Task, error) {
+							lock.Lock()
+							defer lock.Unlock()
+							if time.Now().After(deploymentStart) && running < 5 {
+								running++
+								return []clients.Task{{ID: 111, Description: "create deployment"}}, nil
+							}
+							return []clients.Task{}, nil
+						}
+					})
+					AfterEach(func() {
+						opts.Baseline = 0
+						opts.Tail = 0
+					})
+					It("records the windows around the deployment", func() {
+						Expect(prober.RecordBaseline(time.Second)).To(Equal(111))
+						opts.BoshTask = "111"
+						prober.RecordDowntime()
+
+						results, err := clients.ReadResults(opts.OutputFile)
+						Expect(err).NotTo(HaveOccurred())
+						windows := prober.Windows()
+						Expect(windows.Start).To(BeTemporally("~", results[0].Timestamp, time.Millisecond))
+						baseline := []clients.Result{}
+						for _, result := range results {
+							if result.Timestamp.Before(windows.DeployStart) {
+								baseline = append(baseline, result)
+							}
+						}
+						Expect(baseline).NotTo(BeEmpty())
+						Expect(baseline[len(baseline)-1].Timestamp.Sub(baseline[0].Timestamp)).To(BeNumerically("<=", opts.Baseline))
+						Expect(windows.DeployEnd).To(BeTemporally(">", windows.DeployStart))
+						Expect(windows.End.Sub(windows.DeployEnd)).To(BeNumerically(">=", opts.Tail))
+					})
+				})
+				Context("when stopped while waiting for the deployment", func() {
+					BeforeEach(func() {
+						opts.Interval = 10 * time.Millisecond
+						opts.BoshPollInterval = opts.Interval
+						opts.BoshTask = ""
+						bosh.GetCurrentTasksReturns([]clients.Task{}, nil)
+					})
+					It("stops waiting", func() {
+						go func() {
+							time.Sleep(50 * time.Millisecond)
+							prober.Stop()
+						}()
+						Expect(prober.RecordBaseline(time.Second)).To(Equal(0))
+						Expect(prober.Stopped()).To(BeTrue())
+					})
+				})
+				Context("when bosh events are streamed", func() {
+					BeforeEach(func() {
+						opts.Duration = 0 * time.Second
+						opts.Interval = 50 * time.Millisecond
+						opts.BoshPollInterval = opts.Interval
+						opts.BoshTask = "111"
+						opts.BoshEventInterval = 10 * time.Millisecond
+
+						validTaskCount := 6
+						bosh.GetCurrentTasksStub = func() ([]clients.Task, error) {
+							if validTaskCount > 0 {
+								validTaskCount -= 1
+								return []clients.Task{{ID: 111, Description: "create deployment"}}, nil
+							}
+							return []clients.Task{}, nil
+						}
+						bosh.GetDeploymentTimesReturns(clients.DeploymentTimes{
+							123000: []clients.Annotation{{Action: "update", ObjectType: "instance", ObjectName: "router/0", Phase: "start"}},
+						}, nil)
+					})
+					AfterEach(func() {
+						opts.BoshEventInterval = 0
+					})
+					It("writes new events with the next row", func() {
+						prober.RecordDowntime()
+						Expect(bosh.GetDeploymentTimesCallCount()).To(BeNumerically(">", 1))
+						taskID, filter, since := bosh.GetDeploymentTimesArgsForCall(0)
+						Expect(taskID).To(Equal("111"))
+						Expect(filter).To(BeEmpty())
+						Expect(since.IsZero()).To(BeTrue())
+						_, _, since = bosh.GetDeploymentTimesArgsForCall(1)
+						Expect(since).To(BeTemporally("==", time.Unix(123, 0)))
+
+						outputFile, err := clients.FS.Open(opts.OutputFile)
+						Expect(err).NotTo(HaveOccurred())
+						output, err := ioutil.ReadAll(outputFile)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(bytes.Count(output, []byte("update instance router/0 start"))).To(Equal(1))
+					})
+				})
+				Context("when several deployments are watched", func() {
+					var otherBosh *clientsfakes.FakeBosh
+					BeforeEach(func() {
+						opts.Duration = 0 * time.Second
+						opts.Interval = 20 * time.Millisecond
+						opts.BoshPollInterval = opts.Interval
+						opts.BoshTask = ""
+
+						cfCalls := 0
+						bosh.GetCurrentTasksStub = func() ([]clients.Task, error) {
+							cfCalls++
+							if cfCalls <= 3 {
+								return []clients.Task{{ID: 111, Deployment: "cf", Description: "create deployment"}}, nil
+							}
+							return []clients.Task{}, nil
+						}
+						mysqlCalls := 0
+						otherBosh = new(clientsfakes.FakeBosh)
+						otherBosh.GetCurrentTasksStub = func() ([]clients.Task, error) {
+							mysqlCalls++
+							if mysqlCalls >= 3 && mysqlCalls <= 8 {
+								return []clients.Task{{ID: 222, Deployment: "mysql", Description: "create deployment"}}, nil
+							}
+							return []clients.Task{}, nil
+						}
+						otherBosh.GetTaskStateReturns("done", nil)
+					})
+					JustBeforeEach(func() {
+						prober.Watch(
+							clients.NewWatchedDeployment("", "cf", bosh, clients.NewTaskWatcher(bosh, &opts)),
+							clients.NewWatchedDeployment("other", "mysql", otherBosh, clients.NewTaskWatcher(otherBosh, &opts)),
+						)
+					})
+					AfterEach(func() {
+						opts.Until = ""
+					})
+					It("records until all of their tasks finished", func() {
+						opts.Until = "all"
+						prober.RecordDowntime()
+						results, err := clients.ReadResults(opts.OutputFile)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(len(results)).To(BeNumerically(">=", 7))
+
+						summary, err := prober.AnnotateDeployment()
+						Expect(err).NotTo(HaveOccurred())
+						Expect(otherBosh.GetTaskStagesArgsForCall(0)).To(Equal("222"))
+						Expect(summary.Tasks).To(Equal([]clients.TaskResult{
+							{Deployment: "cf", TaskID: "111"},
+							{Director: "other", Deployment: "mysql", TaskID: "222", State: "done"},
+						}))
+						Expect(summary.String()).To(ContainSubstring("Task 222 of other/mysql finished in state done"))
+					})
+					It("records until any of their tasks finished", func() {
+						opts.Until = "any"
+						prober.RecordDowntime()
+						results, err := clients.ReadResults(opts.OutputFile)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(len(results)).To(BeNumerically("<=", 4))
 					})
 				})
 			})
@@ -207,7 +653,10 @@ var _ = Describe("Clients", func() {
 			var deploymentTimes clients.DeploymentTimes
 			BeforeEach(func() {
 				deploymentTimes = clients.DeploymentTimes{}
-				deploymentTimes[123] = []string{"doppler done", "diego start"}
+				deploymentTimes[123000] = []clients.Annotation{
+					{Action: "update", ObjectType: "instance", ObjectName: "doppler/0", Phase: "done"},
+					{Action: "update", ObjectType: "instance", ObjectName: "diego/1", Phase: "start"},
+				}
 			})
 			Context("when parsing a CSV file", func() {
 				BeforeEach(func() {
@@ -223,7 +672,32 @@ var _ = Describe("Clients", func() {
 					Expect(err).NotTo(HaveOccurred())
 					rewrittenFile, err := ioutil.ReadAll(f)
 					Expect(err).NotTo(HaveOccurred())
-					Expect(string(rewrittenFile)).To(ContainSubstring("doppler done"))
+					Expect(string(rewrittenFile)).To(ContainSubstring("update instance doppler/0 done"))
+				})
+			})
+			Context("when parsing a CSV file in layout version 2", func() {
+				BeforeEach(func() {
+					opts.OutputFile = "/output.csv"
+					Expect(afero.WriteFile(clients.FS, opts.OutputFile, []byte(sampleRecordFileV2), 0644)).To(Succeed())
+				})
+				It("annotates only the first row of a second", func() {
+					err := prober.AnnotateWithTimestamps(deploymentTimes)
+					Expect(err).NotTo(HaveOccurred())
+					rewrittenFile, err := afero.ReadFile(clients.FS, opts.OutputFile)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(rewrittenFile)).To(ContainSubstring("2,123000,1,125.759,200,79,,\"update instance doppler/0 done\n"))
+					Expect(string(rewrittenFile)).To(ContainSubstring("2,123500,0,0.000,0,0,connection refused\n"))
+				})
+				It("annotates the probe right after an event within the same second", func() {
+					deploymentTimes = clients.DeploymentTimes{
+						123200: []clients.Annotation{{Action: "delete", ObjectType: "vm", ObjectName: "vm-1234", Phase: "start"}},
+					}
+					err := prober.AnnotateWithTimestamps(deploymentTimes)
+					Expect(err).NotTo(HaveOccurred())
+					rewrittenFile, err := afero.ReadFile(clients.FS, opts.OutputFile)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(rewrittenFile)).To(ContainSubstring("2,123000,1,125.759,200,79,\n"))
+					Expect(string(rewrittenFile)).To(ContainSubstring("2,123500,0,0.000,0,0,connection refused,delete vm vm-1234 start\n"))
 				})
 			})
 			Context("when the output file cannot be read", func() {
@@ -252,4 +726,276 @@ var _ = Describe("Clients", func() {
 			})
 		})
 	})
+
+	Describe("ParseTaskEvents", func() {
+		const eventOutput = `{"time":100,"stage":"Preparing deployment","tags":[],"total":1,"task":"Preparing deployment","index":1,"state":"started","progress":0}
+{"time":102,"stage":"Preparing deployment","tags":[],"total":1,"task":"Preparing deployment","index":1,"state":"finished","progress":100}
+{"time":110,"stage":"Updating instance","tags":["diego_cell"],"total":2,"task":"diego_cell/abc (0) (canary)","index":1,"state":"started","progress":0}
+{"time":130,"stage":"Updating instance","tags":["diego_cell"],"total":2,"task":"diego_cell/abc (0) (canary)","index":1,"state":"finished","progress":100}
+{"time":131,"stage":"Updating instance","tags":["diego_cell"],"total":2,"task":"diego_cell/def (1)","index":2,"state":"started","progress":0}
+{"time":150,"stage":"Updating instance","tags":["diego_cell"],"total":2,"task":"diego_cell/def (1)","index":2,"state":"failed","progress":100}
+{"time":151,"error":{"code":450001,"message":"something went wrong"}}
+`
+		It("groups events into stages with canaries split out", func() {
+			stages, err := clients.ParseTaskEvents([]byte(eventOutput))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stages).To(HaveLen(3))
+
+			Expect(stages[0].Label()).To(Equal("Preparing deployment"))
+			Expect(stages[0].Start.Unix()).To(Equal(int64(100)))
+			Expect(stages[0].End.Unix()).To(Equal(int64(102)))
+
+			Expect(stages[1].Label()).To(Equal("Updating instance diego_cell (canary)"))
+			Expect(stages[1].Start.Unix()).To(Equal(int64(110)))
+			Expect(stages[1].End.Unix()).To(Equal(int64(130)))
+			Expect(stages[1].Failed).To(BeFalse())
+
+			Expect(stages[2].Label()).To(Equal("Updating instance diego_cell"))
+			Expect(stages[2].Failed).To(BeTrue())
+		})
+
+		It("annotates stage boundaries", func() {
+			stages, err := clients.ParseTaskEvents([]byte(eventOutput))
+			Expect(err).NotTo(HaveOccurred())
+			deploymentTimes := clients.DeploymentTimes{}
+			deploymentTimes.AddStages(stages)
+			Expect(deploymentTimes[110000]).To(HaveLen(1))
+			Expect(deploymentTimes[110000][0].String()).To(Equal("stage Updating instance diego_cell (canary) start"))
+			Expect(deploymentTimes[150000][0].String()).To(Equal("stage Updating instance diego_cell failed"))
+		})
+
+		It("returns an error on malformed output", func() {
+			_, err := clients.ParseTaskEvents([]byte("{not json"))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("BOSH settings", func() {
+		const boshConfig = `environments:
+- url: https://10.0.0.6:25555
+  alias: vbox
+  ca_cert: |-
+    -----BEGIN CERTIFICATE-----
+    vbox
+    -----END CERTIFICATE-----
+  username: admin
+  password: secret
+`
+		BeforeEach(func() {
+			Expect(afero.WriteFile(clients.FS, "/home/.bosh/config", []byte(boshConfig), 0600)).To(Succeed())
+		})
+
+		It("resolves an alias from the bosh CLI config", func() {
+			opts := clients.Opts{BoshHost: "vbox"}
+			Expect(clients.ResolveBoshOpts(&opts, "/home/.bosh/config")).To(Succeed())
+			Expect(opts.BoshHost).To(Equal("https://10.0.0.6:25555"))
+			Expect(opts.BoshCACert).To(ContainSubstring("vbox"))
+			Expect(opts.BoshUser).To(Equal("admin"))
+			Expect(opts.BoshPassword).To(Equal("secret"))
+		})
+
+		It("prefers the options already given", func() {
+			opts := clients.Opts{BoshHost: "https://10.0.0.6:25555", BoshUser: "client", BoshPassword: "client-secret", BoshCACert: "/tmp/ca.pem"}
+			Expect(clients.ResolveBoshOpts(&opts, "/home/.bosh/config")).To(Succeed())
+			Expect(opts.BoshUser).To(Equal("client"))
+			Expect(opts.BoshPassword).To(Equal("client-secret"))
+			Expect(opts.BoshCACert).To(Equal("/tmp/ca.pem"))
+		})
+
+		It("ignores a missing config file", func() {
+			opts := clients.Opts{BoshHost: "bosh.example.com"}
+			Expect(clients.ResolveBoshOpts(&opts, "/nowhere/config")).To(Succeed())
+			Expect(opts.BoshHost).To(Equal("bosh.example.com"))
+		})
+
+		It("takes the settings of another director from the bosh CLI config", func() {
+			opts := clients.Opts{BoshHost: "https://bosh.example.com", BoshUser: "client", BoshPassword: "client-secret", BoshCACert: "/tmp/ca.pem"}
+			directorOpts, err := clients.DirectorOpts(opts, "vbox", "/home/.bosh/config")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(directorOpts.BoshHost).To(Equal("https://10.0.0.6:25555"))
+			Expect(directorOpts.BoshUser).To(Equal("admin"))
+			Expect(directorOpts.BoshCACert).To(ContainSubstring("vbox"))
+
+		})
+
+		It("doesn't pass the credentials of one director on to another", func() {
+			opts := clients.Opts{BoshHost: "https://bosh.example.com", BoshUser: "client", BoshPassword: "client-secret", BoshCACert: "/tmp/ca.pem"}
+			_, err := clients.DirectorOpts(opts, "https://bosh2.example.com", "/home/.bosh/config")
+			Expect(err).To(MatchError("the bosh CLI config /home/.bosh/config has no CA cert and credentials for director https://bosh2.example.com"))
+		})
+
+		It("splits deployments into director and name", func() {
+			director, deployment := clients.ParseDeployment("vbox/cf")
+			Expect(director).To(Equal("vbox"))
+			Expect(deployment).To(Equal("cf"))
+
+			director, deployment = clients.ParseDeployment("https://10.0.0.6:25555/mysql")
+			Expect(director).To(Equal("https://10.0.0.6:25555"))
+			Expect(deployment).To(Equal("mysql"))
+
+			director, deployment = clients.ParseDeployment("rabbitmq")
+			Expect(director).To(BeEmpty())
+			Expect(deployment).To(Equal("rabbitmq"))
+		})
+
+		It("splits the director into host and port", func() {
+			host, port, err := clients.SplitBoshHost("https://10.0.0.6:25556")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(host).To(Equal("10.0.0.6"))
+			Expect(port).To(Equal(25556))
+
+			host, port, err = clients.SplitBoshHost("bosh.example.com")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(host).To(Equal("bosh.example.com"))
+			Expect(port).To(Equal(25555))
+		})
+	})
+
+	Describe("Annotations", func() {
+		It("describes the event and its error", func() {
+			annotation := clients.Annotation{Action: "delete", ObjectType: "vm", ObjectName: "vm-123", Phase: "done", Error: "CPI error"}
+			Expect(annotation.String()).To(Equal("delete vm vm-123 done: CPI error"))
+		})
+		It("is labelled with its director and deployment", func() {
+			annotation := clients.Annotation{Director: "vbox", Deployment: "cf", Action: "update", ObjectType: "instance", ObjectName: "router/0", Phase: "start"}
+			Expect(annotation.String()).To(Equal("vbox/cf: update instance router/0 start"))
+		})
+
+		Describe("EventFilter", func() {
+			It("matches everything when empty", func() {
+				Expect(clients.EventFilter{}.Matches("create", "vm")).To(BeTrue())
+			})
+			It("matches action and object type patterns", func() {
+				filter := clients.EventFilter{"update/instance", "*/disk", "recreate"}
+				Expect(filter.Matches("update", "instance")).To(BeTrue())
+				Expect(filter.Matches("update", "deployment")).To(BeFalse())
+				Expect(filter.Matches("attach", "disk")).To(BeTrue())
+				Expect(filter.Matches("recreate", "instance")).To(BeTrue())
+				Expect(filter.Matches("create", "vm")).To(BeFalse())
+			})
+		})
+	})
+
+	Describe("ReadResults", func() {
+		It("reads all CSV layouts", func() {
+			Expect(afero.WriteFile(clients.FS, "/v1.csv", []byte(sampleRecordFile), 0644)).To(Succeed())
+			results, err := clients.ReadResults("/v1.csv")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(HaveLen(5))
+			Expect(results[0]).To(Equal(clients.Result{Timestamp: time.Unix(123, 0), ResponseTime: 125759040 * time.Nanosecond, StatusCode: 200, Size: 79, Success: 1}))
+
+			Expect(afero.WriteFile(clients.FS, "/v2.csv", []byte(sampleRecordFileV2), 0644)).To(Succeed())
+			results, err = clients.ReadResults("/v2.csv")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(HaveLen(5))
+			Expect(results[0].Timestamp).To(Equal(time.Unix(123, 0)))
+			Expect(results[0].ResponseTime).To(Equal(125759 * time.Microsecond))
+			Expect(results[1].Timestamp).To(Equal(time.Unix(123, 500000000)))
+			Expect(results[1].Error).To(MatchError("connection refused"))
+			Expect(results[1].ErrorClass).To(Equal(clients.ErrorClassConnectRefused))
+
+			Expect(afero.WriteFile(clients.FS, "/v3.csv", []byte(sampleRecordFileV3), 0644)).To(Succeed())
+			results, err = clients.ReadResults("/v3.csv")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(HaveLen(5))
+			Expect(results[0].ErrorClass).To(BeEmpty())
+			Expect(results[1].ErrorClass).To(Equal(clients.ErrorClassConnectRefused))
+			Expect(results[2].ErrorClass).To(Equal(clients.ErrorClassHTTP5xx))
+		})
+	})
+
+	Describe("Summarize", func() {
+		It("attributes downtime to stages", func() {
+			stages := []clients.Stage{
+				{Name: "Updating instance", Tags: []string{"router"}, Canary: true, Start: time.Unix(10, 0), End: time.Unix(20, 0)},
+				{Name: "Updating instance", Tags: []string{"router"}, Start: time.Unix(21, 0), End: time.Unix(30, 0)},
+			}
+			results := []clients.Result{
+				{Timestamp: time.Unix(5, 0), Success: 1},
+				{Timestamp: time.Unix(12, 0), Success: 0},
+				{Timestamp: time.Unix(13, 0), Success: 0},
+				{Timestamp: time.Unix(25, 0), Success: 1},
+			}
+			summary := clients.Summarize(results, stages, time.Second)
+			Expect(summary.Probes).To(Equal(4))
+			Expect(summary.Failures).To(Equal(2))
+			Expect(summary.Downtime).To(Equal(2 * time.Second))
+			Expect(summary.Stages[0].Downtime).To(Equal(2 * time.Second))
+			Expect(summary.Stages[1].Probes).To(Equal(1))
+			Expect(summary.Stages[1].Downtime).To(BeZero())
+			Expect(summary.String()).To(ContainSubstring("Updating instance router (canary): 2 of 2 probes failed, 2s downtime"))
+		})
+		It("takes the downtime from the outages", func() {
+			stages := []clients.Stage{
+				{Name: "Updating instance", Tags: []string{"router"}, Start: time.Unix(10, 0), End: time.Unix(20, 0)},
+				{Name: "Updating instance", Tags: []string{"api"}, Start: time.Unix(21, 0), End: time.Unix(30, 0)},
+			}
+			results := []clients.Result{
+				{Timestamp: time.Unix(5, 0), Success: 0},
+				{Timestamp: time.Unix(12, 0), Success: 0},
+				{Timestamp: time.Unix(13, 0), Success: 0},
+			}
+			summary := clients.Summarize(results, stages, time.Second)
+			summary.SetOutages([]clients.Outage{{Start: time.Unix(18, 0), End: time.Unix(24, 0), Failures: 6}})
+			Expect(summary.Failures).To(Equal(3))
+			Expect(summary.Downtime).To(Equal(6 * time.Second))
+			Expect(summary.Stages[0].Downtime).To(Equal(2 * time.Second))
+			Expect(summary.Stages[1].Downtime).To(Equal(3 * time.Second))
+		})
+		It("breaks the failures down by error class", func() {
+			results := []clients.Result{
+				{Timestamp: time.Unix(1, 0), Success: 0, ErrorClass: clients.ErrorClassConnectRefused},
+				{Timestamp: time.Unix(2, 0), Success: 0, StatusCode: 502},
+				{Timestamp: time.Unix(3, 0), Success: 0, ErrorClass: clients.ErrorClassHTTP5xx},
+				{Timestamp: time.Unix(4, 0), Success: 1},
+			}
+			summary := clients.Summarize(results, nil, time.Second)
+			Expect(summary.FailuresByClass).To(Equal(map[string]int{
+				clients.ErrorClassConnectRefused: 1,
+				clients.ErrorClassHTTP5xx:        2,
+			}))
+			Expect(summary.String()).To(ContainSubstring("failures by class: connect_refused 1, http_5xx 2"))
+		})
+
+		It("reports availability and latency per phase", func() {
+			windows := clients.Windows{
+				Start:       time.Unix(0, 0),
+				DeployStart: time.Unix(10, 0),
+				DeployEnd:   time.Unix(20, 0),
+				End:         time.Unix(30, 0),
+			}
+			results := []clients.Result{
+				{Timestamp: time.Unix(5, 0), Success: 1, ResponseTime: 2 * time.Millisecond},
+				{Timestamp: time.Unix(6, 0), Success: 1, ResponseTime: 4 * time.Millisecond},
+				{Timestamp: time.Unix(12, 0), Success: 0},
+				{Timestamp: time.Unix(13, 0), Success: 1, ResponseTime: 10 * time.Millisecond},
+			}
+			outages := []clients.Outage{{Start: time.Unix(12, 0), End: time.Unix(13, 0), Failures: 1}}
+			phases := clients.SummarizePhases(results, windows, outages)
+			Expect(phases).To(HaveLen(2))
+			Expect(phases[0].Phase).To(Equal("baseline"))
+			Expect(phases[0].Availability()).To(Equal(100.0))
+			Expect(phases[0].P50).To(Equal(2 * time.Millisecond))
+			Expect(phases[0].P95).To(Equal(4 * time.Millisecond))
+			Expect(phases[1].Phase).To(Equal("deploy"))
+			Expect(phases[1].Recorded).To(Equal(3 * time.Second))
+			Expect(phases[1].Downtime).To(Equal(time.Second))
+			Expect(phases[1].Availability()).To(BeNumerically("~", 66.67, 0.01))
+
+			summary := clients.Summary{Phases: phases}
+			Expect(summary.String()).To(ContainSubstring("deploy: 66.67% available, p50 10ms, p95 10ms over 2 probes"))
+		})
+
+		It("reads results back from the CSV", func() {
+			recordFile, err := afero.TempFile(clients.FS, "", "downtime-report.csv")
+			Expect(err).NotTo(HaveOccurred())
+			recordFile.Write([]byte(sampleRecordFile))
+			results, err := clients.ReadResults(recordFile.Name())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(HaveLen(5))
+			Expect(results[0].Timestamp.Unix()).To(Equal(int64(123)))
+			Expect(results[0].ResponseTime).To(Equal(125759040 * time.Nanosecond))
+			Expect(results[0].Success).To(Equal(1))
+		})
+	})
 })
@@ -9,44 +9,59 @@ import (
 )
 
 type FakeBosh struct {
-	GetDeploymentTimesStub        func(taskID string) clients.DeploymentTimes
+	GetDeploymentTimesStub        func(taskID string, filter clients.EventFilter, since time.Time) (clients.DeploymentTimes, error)
 	getDeploymentTimesMutex       sync.RWMutex
 	getDeploymentTimesArgsForCall []struct {
 		taskID string
+		filter clients.EventFilter
+		since  time.Time
 	}
 	getDeploymentTimesReturns struct {
 		result1 clients.DeploymentTimes
+		result2 error
+	}
+	GetTaskStagesStub        func(taskID string) ([]clients.Stage, error)
+	getTaskStagesMutex       sync.RWMutex
+	getTaskStagesArgsForCall []struct {
+		taskID string
 	}
-	GetCurrentTaskIdStub        func() (int, error)
-	getCurrentTaskIdMutex       sync.RWMutex
-	getCurrentTaskIdArgsForCall []struct{}
-	getCurrentTaskIdReturns     struct {
-		result1 int
+	getTaskStagesReturns struct {
+		result1 []clients.Stage
 		result2 error
 	}
-	WaitForTaskIdStub        func(timeout time.Duration) int
-	waitForTaskIdMutex       sync.RWMutex
-	waitForTaskIdArgsForCall []struct {
-		timeout time.Duration
+	GetCurrentTasksStub        func() ([]clients.Task, error)
+	getCurrentTasksMutex       sync.RWMutex
+	getCurrentTasksArgsForCall []struct{}
+	getCurrentTasksReturns     struct {
+		result1 []clients.Task
+		result2 error
 	}
-	waitForTaskIdReturns struct {
-		result1 int
+	GetTaskStateStub        func(taskID string) (string, error)
+	getTaskStateMutex       sync.RWMutex
+	getTaskStateArgsForCall []struct {
+		taskID string
+	}
+	getTaskStateReturns struct {
+		result1 string
+		result2 error
 	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
 
-func (fake *FakeBosh) GetDeploymentTimes(taskID string) clients.DeploymentTimes {
+func (fake *FakeBosh) GetDeploymentTimes(taskID string, filter clients.EventFilter, since time.Time) (clients.DeploymentTimes, error) {
 	fake.getDeploymentTimesMutex.Lock()
 	fake.getDeploymentTimesArgsForCall = append(fake.getDeploymentTimesArgsForCall, struct {
 		taskID string
-	}{taskID})
-	fake.recordInvocation("GetDeploymentTimes", []interface{}{taskID})
+		filter clients.EventFilter
+		since  time.Time
+	}{taskID, filter, since})
+	fake.recordInvocation("GetDeploymentTimes", []interface{}{taskID, filter, since})
 	fake.getDeploymentTimesMutex.Unlock()
 	if fake.GetDeploymentTimesStub != nil {
-		return fake.GetDeploymentTimesStub(taskID)
+		return fake.GetDeploymentTimesStub(taskID, filter, since)
 	} else {
-		return fake.getDeploymentTimesReturns.result1
+		return fake.getDeploymentTimesReturns.result1, fake.getDeploymentTimesReturns.result2
 	}
 }
 
@@ -56,76 +71,112 @@ func (fake *FakeBosh) GetDeploymentTimesCallCount() int {
 	return len(fake.getDeploymentTimesArgsForCall)
 }
 
-func (fake *FakeBosh) GetDeploymentTimesArgsForCall(i int) string {
+func (fake *FakeBosh) GetDeploymentTimesArgsForCall(i int) (string, clients.EventFilter, time.Time) {
 	fake.getDeploymentTimesMutex.RLock()
 	defer fake.getDeploymentTimesMutex.RUnlock()
-	return fake.getDeploymentTimesArgsForCall[i].taskID
+	return fake.getDeploymentTimesArgsForCall[i].taskID, fake.getDeploymentTimesArgsForCall[i].filter, fake.getDeploymentTimesArgsForCall[i].since
 }
 
-func (fake *FakeBosh) GetDeploymentTimesReturns(result1 clients.DeploymentTimes) {
+func (fake *FakeBosh) GetDeploymentTimesReturns(result1 clients.DeploymentTimes, result2 error) {
 	fake.GetDeploymentTimesStub = nil
 	fake.getDeploymentTimesReturns = struct {
 		result1 clients.DeploymentTimes
-	}{result1}
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeBosh) GetTaskStages(taskID string) ([]clients.Stage, error) {
+	fake.getTaskStagesMutex.Lock()
+	fake.getTaskStagesArgsForCall = append(fake.getTaskStagesArgsForCall, struct {
+		taskID string
+	}{taskID})
+	fake.recordInvocation("GetTaskStages", []interface{}{taskID})
+	fake.getTaskStagesMutex.Unlock()
+	if fake.GetTaskStagesStub != nil {
+		return fake.GetTaskStagesStub(taskID)
+	} else {
+		return fake.getTaskStagesReturns.result1, fake.getTaskStagesReturns.result2
+	}
+}
+
+func (fake *FakeBosh) GetTaskStagesCallCount() int {
+	fake.getTaskStagesMutex.RLock()
+	defer fake.getTaskStagesMutex.RUnlock()
+	return len(fake.getTaskStagesArgsForCall)
+}
+
+func (fake *FakeBosh) GetTaskStagesArgsForCall(i int) string {
+	fake.getTaskStagesMutex.RLock()
+	defer fake.getTaskStagesMutex.RUnlock()
+	return fake.getTaskStagesArgsForCall[i].taskID
+}
+
+func (fake *FakeBosh) GetTaskStagesReturns(result1 []clients.Stage, result2 error) {
+	fake.GetTaskStagesStub = nil
+	fake.getTaskStagesReturns = struct {
+		result1 []clients.Stage
+		result2 error
+	}{result1, result2}
 }
 
-func (fake *FakeBosh) GetCurrentTaskId() (int, error) {
-	fake.getCurrentTaskIdMutex.Lock()
-	fake.getCurrentTaskIdArgsForCall = append(fake.getCurrentTaskIdArgsForCall, struct{}{})
-	fake.recordInvocation("GetCurrentTaskId", []interface{}{})
-	fake.getCurrentTaskIdMutex.Unlock()
-	if fake.GetCurrentTaskIdStub != nil {
-		return fake.GetCurrentTaskIdStub()
+func (fake *FakeBosh) GetCurrentTasks() ([]clients.Task, error) {
+	fake.getCurrentTasksMutex.Lock()
+	fake.getCurrentTasksArgsForCall = append(fake.getCurrentTasksArgsForCall, struct{}{})
+	fake.recordInvocation("GetCurrentTasks", []interface{}{})
+	fake.getCurrentTasksMutex.Unlock()
+	if fake.GetCurrentTasksStub != nil {
+		return fake.GetCurrentTasksStub()
 	} else {
-		return fake.getCurrentTaskIdReturns.result1, fake.getCurrentTaskIdReturns.result2
+		return fake.getCurrentTasksReturns.result1, fake.getCurrentTasksReturns.result2
 	}
 }
 
-func (fake *FakeBosh) GetCurrentTaskIdCallCount() int {
-	fake.getCurrentTaskIdMutex.RLock()
-	defer fake.getCurrentTaskIdMutex.RUnlock()
-	return len(fake.getCurrentTaskIdArgsForCall)
+func (fake *FakeBosh) GetCurrentTasksCallCount() int {
+	fake.getCurrentTasksMutex.RLock()
+	defer fake.getCurrentTasksMutex.RUnlock()
+	return len(fake.getCurrentTasksArgsForCall)
 }
 
-func (fake *FakeBosh) GetCurrentTaskIdReturns(result1 int, result2 error) {
-	fake.GetCurrentTaskIdStub = nil
-	fake.getCurrentTaskIdReturns = struct {
-		result1 int
+func (fake *FakeBosh) GetCurrentTasksReturns(result1 []clients.Task, result2 error) {
+	fake.GetCurrentTasksStub = nil
+	fake.getCurrentTasksReturns = struct {
+		result1 []clients.Task
 		result2 error
 	}{result1, result2}
 }
 
-func (fake *FakeBosh) WaitForTaskId(timeout time.Duration) int {
-	fake.waitForTaskIdMutex.Lock()
-	fake.waitForTaskIdArgsForCall = append(fake.waitForTaskIdArgsForCall, struct {
-		timeout time.Duration
-	}{timeout})
-	fake.recordInvocation("WaitForTaskId", []interface{}{timeout})
-	fake.waitForTaskIdMutex.Unlock()
-	if fake.WaitForTaskIdStub != nil {
-		return fake.WaitForTaskIdStub(timeout)
+func (fake *FakeBosh) GetTaskState(taskID string) (string, error) {
+	fake.getTaskStateMutex.Lock()
+	fake.getTaskStateArgsForCall = append(fake.getTaskStateArgsForCall, struct {
+		taskID string
+	}{taskID})
+	fake.recordInvocation("GetTaskState", []interface{}{taskID})
+	fake.getTaskStateMutex.Unlock()
+	if fake.GetTaskStateStub != nil {
+		return fake.GetTaskStateStub(taskID)
 	} else {
-		return fake.waitForTaskIdReturns.result1
+		return fake.getTaskStateReturns.result1, fake.getTaskStateReturns.result2
 	}
 }
 
-func (fake *FakeBosh) WaitForTaskIdCallCount() int {
-	fake.waitForTaskIdMutex.RLock()
-	defer fake.waitForTaskIdMutex.RUnlock()
-	return len(fake.waitForTaskIdArgsForCall)
+func (fake *FakeBosh) GetTaskStateCallCount() int {
+	fake.getTaskStateMutex.RLock()
+	defer fake.getTaskStateMutex.RUnlock()
+	return len(fake.getTaskStateArgsForCall)
 }
 
-func (fake *FakeBosh) WaitForTaskIdArgsForCall(i int) time.Duration {
-	fake.waitForTaskIdMutex.RLock()
-	defer fake.waitForTaskIdMutex.RUnlock()
-	return fake.waitForTaskIdArgsForCall[i].timeout
+func (fake *FakeBosh) GetTaskStateArgsForCall(i int) string {
+	fake.getTaskStateMutex.RLock()
+	defer fake.getTaskStateMutex.RUnlock()
+	return fake.getTaskStateArgsForCall[i].taskID
 }
 
-func (fake *FakeBosh) WaitForTaskIdReturns(result1 int) {
-	fake.WaitForTaskIdStub = nil
-	fake.waitForTaskIdReturns = struct {
-		result1 int
-	}{result1}
+func (fake *FakeBosh) GetTaskStateReturns(result1 string, result2 error) {
+	fake.GetTaskStateStub = nil
+	fake.getTaskStateReturns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
 }
 
 func (fake *FakeBosh) Invocations() map[string][][]interface{} {
@@ -133,10 +184,12 @@ func (fake *FakeBosh) Invocations() map[string][][]interface{} {
 	defer fake.invocationsMutex.RUnlock()
 	fake.getDeploymentTimesMutex.RLock()
 	defer fake.getDeploymentTimesMutex.RUnlock()
-	fake.getCurrentTaskIdMutex.RLock()
-	defer fake.getCurrentTaskIdMutex.RUnlock()
-	fake.waitForTaskIdMutex.RLock()
-	defer fake.waitForTaskIdMutex.RUnlock()
+	fake.getTaskStagesMutex.RLock()
+	defer fake.getTaskStagesMutex.RUnlock()
+	fake.getCurrentTasksMutex.RLock()
+	defer fake.getCurrentTasksMutex.RUnlock()
+	fake.getTaskStateMutex.RLock()
+	defer fake.getTaskStateMutex.RUnlock()
 	return fake.invocations
 }
 
@@ -0,0 +1,167 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Comparison lines up an old and a new recording, e.g. of the deployments
+// of two releases, by the start of their deployments.
+type Comparison struct {
+	Old Report
+	New Report
+}
+
+// ComparisonRow is one of the figures compared.
+type ComparisonRow struct {
+	Name string
+	Old  string
+	New  string
+	// Change is the difference, positive if the new recording is worse.
+	Change string
+}
+
+func Compare(before, after Report) Comparison {
+	return Comparison{Old: before, New: after}
+}
+
+// DowntimeIncrease is how much more downtime the new recording has.
+func (c Comparison) DowntimeIncrease() time.Duration {
+	return c.New.Summary.Downtime - c.Old.Summary.Downtime
+}
+
+func (c Comparison) Rows() []ComparisonRow {
+	rows := []ComparisonRow{
+		durationRow("downtime", c.Old.Summary.Downtime, c.New.Summary.Downtime),
+		countRow("failed probes", c.Old.Summary.Failures, c.New.Summary.Failures),
+	}
+	for _, class := range ErrorClasses {
+		before, after := c.Old.Summary.FailuresByClass[class], c.New.Summary.FailuresByClass[class]
+		if before > 0 || after > 0 {
+			rows = append(rows, countRow("  "+class, before, after))
+		}
+	}
+	rows = append(rows,
+		countRow("outages", len(c.Old.Summary.Outages), len(c.New.Summary.Outages)),
+		countRow("flapping outages", flapping(c.Old.Summary.Outages), flapping(c.New.Summary.Outages)),
+		durationRow("longest outage", longestOutage(c.Old.Summary.Outages), longestOutage(c.New.Summary.Outages)),
+		durationRow("latency p50", c.Old.Summary.P50, c.New.Summary.P50),
+		durationRow("latency p95", c.Old.Summary.P95, c.New.Summary.P95),
+		durationRow("deployment", deployDuration(c.Old), deployDuration(c.New)),
+	)
+
+	oldGroups := c.Old.InstanceGroupDowntime()
+	newGroups := c.New.InstanceGroupDowntime()
+	groups := []string{}
+	for group := range oldGroups {
+		groups = append(groups, group)
+	}
+	for group := range newGroups {
+		if _, ok := oldGroups[group]; !ok {
+			groups = append(groups, group)
+		}
+	}
+	sort.Strings(groups)
+	for _, group := range groups {
+		row := durationRow("updating "+group, oldGroups[group], newGroups[group])
+		if _, ok := oldGroups[group]; !ok {
+			row.Old = "-"
+		}
+		if _, ok := newGroups[group]; !ok {
+			row.New = "-"
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func (c Comparison) String() string {
+	output := bytes.Buffer{}
+	table := tabwriter.NewWriter(&output, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(table, "\told\tnew\tchange\n")
+	for _, row := range c.Rows() {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", row.Name, row.Old, row.New, row.Change)
+	}
+	table.Flush()
+
+	lines := []string{
+		"old: " + c.Old.description(),
+		"new: " + c.New.description(),
+		strings.TrimRight(output.String(), "\n"),
+	}
+	for _, recording := range []struct {
+		name   string
+		report Report
+	}{{"old", c.Old}, {"new", c.New}} {
+		for _, outage := range recording.report.Summary.Outages {
+			lines = append(lines, fmt.Sprintf("%s outage %s after the deployment started: %s", recording.name, signed(outage.Start.Sub(recording.report.DeployStart)), outage))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (r Report) description() string {
+	description := r.Recording
+	if r.Target != "" {
+		description += " of " + r.Target
+	}
+	return description + ", deployment started " + r.DeployStart.Format("2006-01-02 15:04:05 MST")
+}
+
+func durationRow(name string, before, after time.Duration) ComparisonRow {
+	return ComparisonRow{Name: name, Old: before.String(), New: after.String(), Change: signed(after - before)}
+}
+
+func countRow(name string, before, after int) ComparisonRow {
+	return ComparisonRow{Name: name, Old: fmt.Sprint(before), New: fmt.Sprint(after), Change: fmt.Sprintf("%+d", after-before)}
+}
+
+func signed(duration time.Duration) string {
+	if duration < 0 {
+		return duration.String()
+	}
+	return "+" + duration.String()
+}
+
+func longestOutage(outages []Outage) time.Duration {
+	longest := time.Duration(0)
+	for _, outage := range outages {
+		if outage.Duration() > longest {
+			longest = outage.Duration()
+		}
+	}
+	return longest
+}
+
+func flapping(outages []Outage) int {
+	count := 0
+	for _, outage := range outages {
+		if outage.Flapping {
+			count++
+		}
+	}
+	return count
+}
+
+func deployDuration(r Report) time.Duration {
+	return r.DeployEnd.Sub(r.DeployStart)
+}
@@ -0,0 +1,83 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients_test
+
+import (
+	"time"
+
+	"github.com/pivotal-cf/downtimer/clients"
+	"github.com/spf13/afero"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Compare", func() {
+	var comparison clients.Comparison
+
+	BeforeEach(func() {
+		clients.FS = afero.NewMemMapFs()
+		opts := clients.Opts{Interval: time.Second, OutageFailures: 3, OutageSuccesses: 3}
+
+		oldStart := time.Date(2017, 8, 1, 10, 0, 0, 0, time.UTC)
+		writeRecording("/old.csv", oldStart, 60, func(i int) bool { return i >= 30 && i < 34 }, map[int]string{
+			10: "window deploy start",
+			25: "update instance router/abc start",
+			40: "update instance router/abc done",
+			50: "window deploy done",
+		})
+		newStart := time.Date(2017, 9, 1, 14, 0, 0, 0, time.UTC)
+		writeRecording("/new.csv", newStart, 60, func(i int) bool { return (i >= 20 && i < 30) || (i >= 40 && i < 43) || i == 55 }, map[int]string{
+			5:  "window deploy start",
+			15: "update instance router/def start",
+			32: "update instance router/def done",
+			38: "update instance api/xyz start",
+			45: "update instance api/xyz done",
+			50: "window deploy done",
+		})
+
+		before, err := clients.NewReport("/old.csv", &opts)
+		Expect(err).NotTo(HaveOccurred())
+		after, err := clients.NewReport("/new.csv", &opts)
+		Expect(err).NotTo(HaveOccurred())
+		comparison = clients.Compare(before, after)
+	})
+
+	It("compares downtime, outages, latency and the downtime per instance group", func() {
+		Expect(comparison.DowntimeIncrease()).To(Equal(9 * time.Second))
+		Expect(comparison.Rows()).To(Equal([]clients.ComparisonRow{
+			{Name: "downtime", Old: "4s", New: "13s", Change: "+9s"},
+			{Name: "failed probes", Old: "4", New: "14", Change: "+10"},
+			{Name: "  http_5xx", Old: "4", New: "14", Change: "+10"},
+			{Name: "outages", Old: "1", New: "2", Change: "+1"},
+			{Name: "flapping outages", Old: "0", New: "0", Change: "+0"},
+			{Name: "longest outage", Old: "4s", New: "10s", Change: "+6s"},
+			{Name: "latency p50", Old: "3.5ms", New: "3.5ms", Change: "+0s"},
+			{Name: "latency p95", Old: "3.5ms", New: "3.5ms", Change: "+0s"},
+			{Name: "deployment", Old: "40s", New: "45s", Change: "+5s"},
+			{Name: "updating api", Old: "-", New: "3s", Change: "+3s"},
+			{Name: "updating router", Old: "4s", New: "10s", Change: "+6s"},
+		}))
+	})
+
+	It("lines up the outages by the start of the deployments", func() {
+		text := comparison.String()
+		Expect(text).To(ContainSubstring("old outage +20s after the deployment started: down from 10:00:30"))
+		Expect(text).To(ContainSubstring("new outage +15s after the deployment started: down from 14:00:20"))
+		Expect(text).To(ContainSubstring("new outage +35s after the deployment started: down from 14:00:40"))
+		Expect(text).To(MatchRegexp(`downtime +4s +13s +\+9s`))
+	})
+})
@@ -0,0 +1,201 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+)
+
+// ConfigArgs turns the settings of a YAML or JSON config file into command
+// line arguments. They go ahead of the actual command line, so that flags
+// override the file. Settings of list options that are also given on the
+// command line are left out, as the values would add up otherwise.
+//
+// The file has a section per topic, and a key per option, e.g.
+//
+//	target:
+//	  url: https://app.example.com/health
+//	bosh:
+//	  client_secret: ${BOSH_CLIENT_SECRET}
+func ConfigArgs(path string, commandLine []string) ([]string, error) {
+	configFile, err := FS.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer configFile.Close()
+	configBytes, err := ioutil.ReadAll(configFile)
+	if err != nil {
+		return nil, err
+	}
+	config := map[string]map[string]interface{}{}
+	if err := yaml.Unmarshal(configBytes, &config); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	options := configOptions()
+	keys := []string{}
+	for section, settings := range config {
+		for name := range settings {
+			keys = append(keys, section+"."+name)
+		}
+	}
+	sort.Strings(keys)
+
+	args := []string{}
+	for _, key := range keys {
+		field, ok := options[key]
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown setting %s", path, key)
+		}
+		keyParts := strings.SplitN(key, ".", 2)
+		values, err := configValues(field, config[keyParts[0]][keyParts[1]])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %s", path, key, err)
+		}
+		if field.Type.Kind() == reflect.Slice && givenOnCommandLine(field, commandLine) {
+			continue
+		}
+		flag := "--" + field.Tag.Get("long")
+		for _, value := range values {
+			if field.Type.Kind() == reflect.Bool {
+				args = append(args, flag)
+				continue
+			}
+			args = append(args, flag+"="+value)
+		}
+	}
+	return args, nil
+}
+
+func configOptions() map[string]reflect.StructField {
+	options := map[string]reflect.StructField{}
+	optsType := reflect.TypeOf(Opts{})
+	for i := 0; i < optsType.NumField(); i++ {
+		field := optsType.Field(i)
+		if key := field.Tag.Get("config"); key != "" {
+			options[key] = field
+		}
+	}
+	return options
+}
+
+// configValues validates a setting and returns its values as they would be
+// given on the command line. A false bool has no values.
+func configValues(field reflect.StructField, value interface{}) ([]string, error) {
+	if field.Type.Kind() != reflect.Slice {
+		configValue, err := configValue(field.Type, value)
+		if err != nil {
+			return nil, err
+		}
+		if enabled, _ := strconv.ParseBool(configValue); field.Type.Kind() == reflect.Bool && !enabled {
+			return nil, nil
+		}
+		return []string{configValue}, nil
+	}
+
+	items, ok := value.([]interface{})
+	if !ok {
+		items = []interface{}{value}
+	}
+	values := []string{}
+	for _, item := range items {
+		configValue, err := configValue(field.Type.Elem(), item)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, configValue)
+	}
+	return values, nil
+}
+
+func configValue(valueType reflect.Type, value interface{}) (string, error) {
+	var text string
+	switch typedValue := value.(type) {
+	case string:
+		interpolated, err := interpolate(typedValue)
+		if err != nil {
+			return "", err
+		}
+		text = interpolated
+	case int, float64, bool:
+		text = fmt.Sprint(typedValue)
+	default:
+		return "", fmt.Errorf("expected a single value, got %v", value)
+	}
+
+	var err error
+	switch {
+	case valueType == durationType:
+		_, err = time.ParseDuration(text)
+	case valueType.Kind() == reflect.Bool:
+		_, err = strconv.ParseBool(text)
+	case valueType.Kind() == reflect.Int:
+		_, err = strconv.Atoi(text)
+	case valueType.Kind() == reflect.Float64:
+		_, err = strconv.ParseFloat(text, 64)
+	}
+	if err != nil {
+		return "", fmt.Errorf("invalid value %q", text)
+	}
+	return text, nil
+}
+
+// interpolate replaces ${VAR} with the value of the environment variable,
+// so that secrets can be kept out of the file.
+func interpolate(value string) (string, error) {
+	var err error
+	interpolated := envReference.ReplaceAllStringFunc(value, func(reference string) string {
+		name := envReference.FindStringSubmatch(reference)[1]
+		envValue, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("environment variable %s is not set", name)
+		}
+		return envValue
+	})
+	return interpolated, err
+}
+
+func givenOnCommandLine(field reflect.StructField, commandLine []string) bool {
+	long := "--" + field.Tag.Get("long")
+	short := field.Tag.Get("short")
+	for _, arg := range commandLine {
+		if arg == "--" {
+			break
+		}
+		if arg == long || strings.HasPrefix(arg, long+"=") {
+			return true
+		}
+		if short != "" && !strings.HasPrefix(arg, "--") && strings.HasPrefix(arg, "-"+short) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients_test
+
+import (
+	"os"
+	"time"
+
+	"github.com/pivotal-cf/downtimer/clients"
+	"github.com/spf13/afero"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Config file", func() {
+	const config = `target:
+  url: ${DOWNTIMER_TEST_URL}/health
+  interval: 200ms
+  skip_ssl_validation: true
+success:
+  status: [200, 204]
+bosh:
+  deployments: [cf, services/mysql]
+  client_secret: ${DOWNTIMER_TEST_SECRET}
+slo:
+  min_availability: 99.9
+`
+
+	BeforeEach(func() {
+		clients.FS = afero.NewMemMapFs()
+		os.Setenv("DOWNTIMER_TEST_URL", "https://app.example.com")
+		os.Setenv("DOWNTIMER_TEST_SECRET", "s3cr3t")
+		Expect(afero.WriteFile(clients.FS, "/downtimer.yml", []byte(config), 0600)).To(Succeed())
+	})
+	AfterEach(func() {
+		os.Unsetenv("DOWNTIMER_TEST_URL")
+		os.Unsetenv("DOWNTIMER_TEST_SECRET")
+	})
+
+	It("turns the settings into flags", func() {
+		args, err := clients.ConfigArgs("/downtimer.yml", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(args).To(Equal([]string{
+			"--password=s3cr3t",
+			"--deployment=cf",
+			"--deployment=services/mysql",
+			"--slo-min-availability=99.9",
+			"--expect-status=200",
+			"--expect-status=204",
+			"--interval=200ms",
+			"--skip-ssl-validation",
+			"--url=https://app.example.com/health",
+		}))
+	})
+
+	It("leaves out lists given on the command line", func() {
+		args, err := clients.ConfigArgs("/downtimer.yml", []string{"--deployment", "rabbitmq"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(args).NotTo(ContainElement("--deployment=cf"))
+	})
+
+	It("reads JSON", func() {
+		Expect(afero.WriteFile(clients.FS, "/downtimer.json", []byte(`{"recording": {"duration": "5m", "tail": "1m"}}`), 0600)).To(Succeed())
+		args, err := clients.ConfigArgs("/downtimer.json", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(args).To(Equal([]string{"--duration=5m", "--tail=1m"}))
+	})
+
+	Describe("invalid settings", func() {
+		configError := func(config string) error {
+			Expect(afero.WriteFile(clients.FS, "/invalid.yml", []byte(config), 0600)).To(Succeed())
+			_, err := clients.ConfigArgs("/invalid.yml", nil)
+			return err
+		}
+
+		It("rejects unknown settings", func() {
+			Expect(configError("target:\n  uri: http://example.com\n")).To(MatchError("/invalid.yml: unknown setting target.uri"))
+		})
+		It("rejects invalid values", func() {
+			Expect(configError("target:\n  interval: often\n")).To(MatchError(`/invalid.yml: target.interval: invalid value "often"`))
+			Expect(configError("target:\n  url: [a, b]\n")).To(MatchError("/invalid.yml: target.url: expected a single value, got [a b]"))
+		})
+		It("rejects references to unset environment variables", func() {
+			Expect(configError("bosh:\n  client_secret: ${DOWNTIMER_TEST_UNSET}\n")).To(MatchError("/invalid.yml: bosh.client_secret: environment variable DOWNTIMER_TEST_UNSET is not set"))
+		})
+	})
+
+	Describe("Opts.ReadBoshEnv", func() {
+		BeforeEach(func() {
+			os.Setenv("BOSH_ENVIRONMENT", "vbox")
+			os.Setenv("BOSH_CLIENT", "admin")
+		})
+		AfterEach(func() {
+			os.Unsetenv("BOSH_ENVIRONMENT")
+			os.Unsetenv("BOSH_CLIENT")
+		})
+
+		It("ignores the bosh CLI's environment unless asked to read it", func() {
+			opts := clients.Opts{}
+			opts.ReadBoshEnv()
+			Expect(opts.BoshHost).To(BeEmpty())
+			Expect(opts.BoshUser).To(BeEmpty())
+		})
+
+		It("fills in the bosh options not given from the environment", func() {
+			opts := clients.Opts{BoshFromEnv: true, BoshUser: "client"}
+			opts.ReadBoshEnv()
+			Expect(opts.BoshHost).To(Equal("vbox"))
+			Expect(opts.BoshUser).To(Equal("client"))
+		})
+	})
+
+	Describe("Opts.Validate", func() {
+		It("requires an http URL and a positive interval", func() {
+			opts := clients.Opts{URL: "app.example.com", Interval: time.Second, BoshPollInterval: time.Second, OutageFailures: 3, OutageSuccesses: 3}
+			Expect(opts.Validate()).To(MatchError("the URL to probe must be an http or https URL: app.example.com"))
+			opts.URL = "http://app.example.com"
+			Expect(opts.Validate()).To(Succeed())
+			opts.Interval = 0
+			Expect(opts.Validate()).To(MatchError("the probe interval must be positive"))
+		})
+	})
+})
+
+var _ = Describe("SLOs", func() {
+	It("checks the objectives that are set", func() {
+		summary := clients.Summary{Probes: 1000, Failures: 2, Recorded: 1000 * time.Second, Downtime: 2 * time.Second, P95: 300 * time.Millisecond}
+		opts := clients.Opts{SLOMaxDowntime: time.Second, SLOMinAvailability: 99.5}
+		results := clients.CheckSLOs(summary, &opts)
+		Expect(results).To(HaveLen(2))
+		Expect(results[0].String()).To(Equal("SLO max downtime 1s: 2s, breached"))
+		Expect(results[1].String()).To(Equal("SLO min availability 99.500%: 99.800%, met"))
+		Expect(clients.SLOsMet(results)).To(BeFalse())
+	})
+})
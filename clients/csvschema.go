@@ -0,0 +1,145 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// csvSchema is the version of the CSV layout written by RecordDowntime. It
+// is the first column of every row.
+//
+// Version 3 adds the error class of a failed probe. Version 2 has
+// timestamps in milliseconds since the epoch, latency in milliseconds and an
+// error column. The first version, without a version column, had timestamps
+// in seconds and latency as a Go duration. Recordings in version 2 are
+// appended to in their own layout.
+const csvSchema = 3
+
+var csvHeader = []string{"version", "timestamp_ms", "success", "latency_ms", "code", "size", "error", "error_class", "annotation"}
+
+// csvVersion tells the version of a recording by its header.
+func csvVersion(header []string) (int, error) {
+	if len(header) > 0 && header[0] == "timestamp" {
+		return 1, nil
+	}
+	if len(header) > 7 && header[0] == "version" && header[7] == "error_class" {
+		return csvSchema, nil
+	}
+	if len(header) > 0 && header[0] == "version" {
+		return 2, nil
+	}
+	return 0, fmt.Errorf("unexpected header %q", header)
+}
+
+// getCvsRow returns the columns of a result in the layout version, which
+// is 2 or later, without the annotation.
+func getCvsRow(result Result, version int) []string {
+	resultError := ""
+	if result.Error != nil {
+		resultError = result.Error.Error()
+	}
+	latency := float64(result.ResponseTime) / float64(time.Millisecond)
+	row := []string{
+		strconv.Itoa(version),
+		strconv.FormatInt(unixMillis(result.Timestamp), 10),
+		strconv.Itoa(result.Success),
+		strconv.FormatFloat(latency, 'f', 3, 64),
+		strconv.Itoa(result.StatusCode),
+		strconv.Itoa(result.Size),
+		resultError,
+	}
+	if version > 2 {
+		row = append(row, result.ErrorClass)
+	}
+	return row
+}
+
+func parseCsvRow(record []string, version int) (Result, error) {
+	if version == 1 {
+		result, err := parseCsvRowV1(record)
+		result.ErrorClass = classifyResult(result)
+		return result, err
+	}
+	if len(record) < 7 {
+		return Result{}, fmt.Errorf("expected at least 7 fields, got %d", len(record))
+	}
+	timestamp, err := strconv.ParseInt(record[1], 10, 64)
+	if err != nil {
+		return Result{}, err
+	}
+	success, err := strconv.Atoi(record[2])
+	if err != nil {
+		return Result{}, err
+	}
+	latency, err := strconv.ParseFloat(record[3], 64)
+	if err != nil {
+		return Result{}, err
+	}
+	result := Result{
+		Timestamp:    time.Unix(0, timestamp*int64(time.Millisecond)),
+		ResponseTime: time.Duration(latency * float64(time.Millisecond)),
+		Success:      success,
+	}
+	if result.StatusCode, err = strconv.Atoi(record[4]); err != nil {
+		return Result{}, err
+	}
+	if result.Size, err = strconv.Atoi(record[5]); err != nil {
+		return Result{}, err
+	}
+	if record[6] != "" {
+		result.Error = errors.New(record[6])
+	}
+	if version > 2 && len(record) > 7 && isErrorClass(record[7]) {
+		result.ErrorClass = record[7]
+	} else {
+		result.ErrorClass = classifyResult(result)
+	}
+	return result, nil
+}
+
+func parseCsvRowV1(record []string) (Result, error) {
+	if len(record) < 5 {
+		return Result{}, fmt.Errorf("expected at least 5 fields, got %d", len(record))
+	}
+	timestamp, err := strconv.ParseInt(record[0], 10, 64)
+	if err != nil {
+		return Result{}, err
+	}
+	success, err := strconv.Atoi(record[1])
+	if err != nil {
+		return Result{}, err
+	}
+	result := Result{Timestamp: time.Unix(timestamp, 0), Success: success}
+	if record[2] != "" {
+		if result.ResponseTime, err = time.ParseDuration(record[2]); err != nil {
+			return Result{}, err
+		}
+	}
+	if result.StatusCode, err = strconv.Atoi(record[3]); err != nil {
+		return Result{}, err
+	}
+	if result.Size, err = strconv.Atoi(record[4]); err != nil {
+		return Result{}, err
+	}
+	if len(record) > 5 && record[5] != "" {
+		result.Error = errors.New(record[5])
+	}
+	return result, nil
+}
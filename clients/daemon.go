@@ -0,0 +1,155 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"sync"
+)
+
+// Daemon records every deployment task that starts on the director.
+// The recordings share the daemon's task watcher.
+type Daemon struct {
+	opts    *Opts
+	bosh    Bosh
+	tasks   *TaskWatcher
+	seen    map[int]bool
+	lock    sync.Mutex
+	probers map[int]*Prober
+	metrics *Metrics
+}
+
+func NewDaemon(opts *Opts, bosh Bosh) *Daemon {
+	return &Daemon{opts: opts, bosh: bosh, tasks: NewTaskWatcher(bosh, opts), seen: map[int]bool{}, probers: map[int]*Prober{}}
+}
+
+// UseMetrics exposes the results of all recordings.
+func (d *Daemon) UseMetrics(metrics *Metrics) {
+	d.metrics = metrics
+}
+
+// Run watches the director's tasks until stop is closed. Recordings in
+// progress are then stopped and annotated before Run returns.
+func (d *Daemon) Run(stop <-chan struct{}) {
+	updates, unsubscribe := d.tasks.Subscribe()
+	defer unsubscribe()
+
+	var recordings sync.WaitGroup
+	for {
+		select {
+		case <-stop:
+			d.lock.Lock()
+			for _, prober := range d.probers {
+				prober.Stop()
+			}
+			d.lock.Unlock()
+			recordings.Wait()
+			return
+		case tasks := <-updates:
+			current := map[int]bool{}
+			for _, task := range tasks {
+				current[task.ID] = true
+				if d.seen[task.ID] || !d.watches(task) {
+					continue
+				}
+				d.seen[task.ID] = true
+				prober := d.newProber(task)
+				d.lock.Lock()
+				d.probers[task.ID] = prober
+				d.lock.Unlock()
+				recordings.Add(1)
+				go d.record(task, prober, &recordings)
+			}
+			// Task IDs aren't reused, so a task that is gone is gone
+			// for good.
+			for id := range d.seen {
+				if !current[id] {
+					delete(d.seen, id)
+				}
+			}
+		}
+	}
+}
+
+// Recordings is the number of recordings in progress.
+func (d *Daemon) Recordings() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return len(d.probers)
+}
+
+func (d *Daemon) watches(task Task) bool {
+	if !task.IsDeploy() {
+		return false
+	}
+	if len(d.opts.Deployments) == 0 {
+		return true
+	}
+	for _, deployment := range d.opts.Deployments {
+		if deployment == task.Deployment {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Daemon) newProber(task Task) *Prober {
+	opts := *d.opts
+	opts.BoshTask = fmt.Sprint(task.ID)
+	opts.Duration = 0
+	format := d.opts.Format
+	if format == "" {
+		format = FormatCSV
+	}
+	opts.OutputFile = filepath.Join(d.opts.OutputDir, fmt.Sprintf("%s-%d.%s", task.Deployment, task.ID, format))
+	if opts.JUnitFile != "" {
+		opts.JUnitFile = filepath.Join(d.opts.OutputDir, fmt.Sprintf("%s-%d.xml", task.Deployment, task.ID))
+	}
+	prober := NewProber(&opts, d.bosh)
+	prober.UseTaskWatcher(d.tasks)
+	prober.UseMetrics(d.metrics)
+	return prober
+}
+
+func (d *Daemon) record(task Task, prober *Prober, recordings *sync.WaitGroup) {
+	defer recordings.Done()
+	defer func() {
+		d.lock.Lock()
+		defer d.lock.Unlock()
+		delete(d.probers, task.ID)
+	}()
+
+	log.Println(fmt.Sprintf("Recording task %d of deployment %s to %s", task.ID, task.Deployment, prober.opts.OutputFile))
+	if err := prober.RecordDowntime(); err != nil {
+		log.Println(err)
+		return
+	}
+	summary, err := prober.AnnotateDeployment()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	log.Println(fmt.Sprintf("Task %d of deployment %s finished\n%s", task.ID, task.Deployment, summary))
+	slos := CheckSLOs(summary, prober.opts)
+	for _, slo := range slos {
+		log.Println(slo)
+	}
+	if err := prober.WriteJUnitReport(summary, slos); err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,97 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients_test
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pivotal-cf/downtimer/clients"
+	"github.com/pivotal-cf/downtimer/clients/clientsfakes"
+	"github.com/spf13/afero"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Daemon", func() {
+	var bosh *clientsfakes.FakeBosh
+	var opts clients.Opts
+
+	BeforeEach(func() {
+		clients.FS = afero.NewMemMapFs()
+		bosh = new(clientsfakes.FakeBosh)
+		opts = clients.Opts{
+			URL:              mockServer.URL + "/health",
+			Interval:         10 * time.Millisecond,
+			BoshPollInterval: 10 * time.Millisecond,
+			OutputDir:        "/recordings",
+			Deployments:      []string{"cf"},
+		}
+
+		var lock sync.Mutex
+		polls := 0
+		bosh.GetCurrentTasksStub = func() ([]clients.Task, error) {
+			lock.Lock()
+			defer lock.Unlock()
+			polls++
+			if polls > 10 {
+				return []clients.Task{}, nil
+			}
+			return []clients.Task{
+				{ID: 7, Deployment: "cf", Description: "create deployment"},
+				{ID: 8, Deployment: "mysql", Description: "create deployment"},
+				{ID: 9, Deployment: "cf", Description: "run errand smoke-tests"},
+			}, nil
+		}
+	})
+
+	It("records the deployment tasks of the configured deployments", func() {
+		stop := make(chan struct{})
+		finished := make(chan struct{})
+		go func() {
+			clients.NewDaemon(&opts, bosh).Run(stop)
+			close(finished)
+		}()
+		Eventually(bosh.GetTaskStagesCallCount, 5*time.Second).Should(Equal(1))
+		close(stop)
+		Eventually(finished).Should(BeClosed())
+
+		exists, err := afero.Exists(clients.FS, "/recordings/cf-7.csv")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(exists).To(BeTrue())
+		exists, err = afero.Exists(clients.FS, "/recordings/mysql-8.csv")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(exists).To(BeFalse())
+
+		Expect(bosh.GetTaskStagesCallCount()).To(Equal(1))
+		Expect(bosh.GetTaskStagesArgsForCall(0)).To(Equal("7"))
+	})
+
+	It("forgets recordings once they finished", func() {
+		stop := make(chan struct{})
+		daemon := clients.NewDaemon(&opts, bosh)
+		finished := make(chan struct{})
+		go func() {
+			daemon.Run(stop)
+			close(finished)
+		}()
+		Eventually(daemon.Recordings).Should(Equal(1))
+		Eventually(daemon.Recordings, 5*time.Second).Should(BeZero())
+		close(stop)
+		Eventually(finished).Should(BeClosed())
+	})
+})
@@ -0,0 +1,96 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients
+
+import (
+	"strings"
+	"sync"
+)
+
+// WatchedDeployment is a deployment whose deploy task is recorded, possibly
+// on a director of its own. The task is found once it starts, among the
+// tasks polled by the director's task watcher.
+type WatchedDeployment struct {
+	Director   string
+	Deployment string
+	Bosh       Bosh
+	Tasks      *TaskWatcher
+	taskID     string
+	lock       sync.Mutex
+}
+
+// TaskResult is the final state of the task of a watched deployment.
+type TaskResult struct {
+	Director   string `json:"director,omitempty"`
+	Deployment string `json:"deployment,omitempty"`
+	TaskID     string `json:"task"`
+	State      string `json:"state"`
+}
+
+func NewWatchedDeployment(director, deployment string, bosh Bosh, tasks *TaskWatcher) *WatchedDeployment {
+	return &WatchedDeployment{Director: director, Deployment: deployment, Bosh: bosh, Tasks: tasks}
+}
+
+// ParseDeployment splits "[director/]deployment", the director being an
+// alias or URL.
+func ParseDeployment(spec string) (string, string) {
+	separator := strings.LastIndex(spec, "/")
+	if separator < 0 {
+		return "", spec
+	}
+	return spec[:separator], spec[separator+1:]
+}
+
+func (d *WatchedDeployment) Label() string {
+	return deploymentLabel(d.Director, d.Deployment)
+}
+
+func (d *WatchedDeployment) TaskID() string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.taskID
+}
+
+func (d *WatchedDeployment) setTaskID(taskID string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.taskID = taskID
+}
+
+// findTask looks for a deploy task of the deployment among the current tasks.
+func (d *WatchedDeployment) findTask(tasks []Task) (Task, bool) {
+	for _, task := range tasks {
+		if task.IsDeploy() && task.Deployment == d.Deployment {
+			return task, true
+		}
+	}
+	return Task{}, false
+}
+
+func (r TaskResult) String() string {
+	label := deploymentLabel(r.Director, r.Deployment)
+	if label == "" {
+		return "Task " + r.TaskID
+	}
+	return "Task " + r.TaskID + " of " + label
+}
+
+func deploymentLabel(director, deployment string) string {
+	if director == "" {
+		return deployment
+	}
+	return director + "/" + deployment
+}
@@ -0,0 +1,123 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Classes of why a probe failed, recorded with every failed probe.
+const (
+	ErrorClassDNS            = "dns"
+	ErrorClassConnectRefused = "connect_refused"
+	ErrorClassConnectTimeout = "connect_timeout"
+	ErrorClassTLS            = "tls"
+	ErrorClassReadTimeout    = "read_timeout"
+	ErrorClassHTTP5xx        = "http_5xx"
+	ErrorClassHTTP4xx        = "http_4xx"
+	ErrorClassBodyMismatch   = "body_mismatch"
+	ErrorClassOther          = "other"
+)
+
+// ErrorClasses lists the classes in the order they are reported in.
+var ErrorClasses = []string{
+	ErrorClassDNS,
+	ErrorClassConnectRefused,
+	ErrorClassConnectTimeout,
+	ErrorClassTLS,
+	ErrorClassReadTimeout,
+	ErrorClassHTTP5xx,
+	ErrorClassHTTP4xx,
+	ErrorClassBodyMismatch,
+	ErrorClassOther,
+}
+
+func isErrorClass(class string) bool {
+	for _, known := range ErrorClasses {
+		if class == known {
+			return true
+		}
+	}
+	return false
+}
+
+func classifyError(err error) string {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	switch e := err.(type) {
+	case *net.DNSError:
+		return ErrorClassDNS
+	case *net.OpError:
+		if _, ok := e.Err.(*net.DNSError); ok {
+			return ErrorClassDNS
+		}
+		if e.Op == "dial" && e.Timeout() {
+			return ErrorClassConnectTimeout
+		}
+	case x509.UnknownAuthorityError, x509.HostnameError, x509.CertificateInvalidError, tls.RecordHeaderError:
+		return ErrorClassTLS
+	}
+	return classifyMessage(err.Error())
+}
+
+// classifyMessage tells the class of an error by its text, which is all
+// that is left of it in a recording.
+func classifyMessage(text string) string {
+	switch {
+	case strings.Contains(text, "no such host"), strings.Contains(text, "server misbehaving"):
+		return ErrorClassDNS
+	case strings.Contains(text, "connection refused"):
+		return ErrorClassConnectRefused
+	case strings.Contains(text, "tls:"), strings.Contains(text, "x509:"), strings.Contains(text, "TLS handshake"):
+		return ErrorClassTLS
+	case strings.Contains(text, "dial tcp") && strings.Contains(text, "timeout"),
+		strings.Contains(text, "waiting for connection"):
+		return ErrorClassConnectTimeout
+	case strings.Contains(text, "timeout"), strings.Contains(text, "Timeout"),
+		strings.Contains(text, "deadline exceeded"):
+		return ErrorClassReadTimeout
+	case strings.HasPrefix(text, "response body does not match"):
+		return ErrorClassBodyMismatch
+	}
+	return ErrorClassOther
+}
+
+func classifyStatus(code int) string {
+	switch {
+	case code >= 500:
+		return ErrorClassHTTP5xx
+	case code >= 400:
+		return ErrorClassHTTP4xx
+	}
+	return ErrorClassOther
+}
+
+// classifyResult tells the class of a failed probe read from a recording
+// that doesn't have one, or has one of an older version.
+func classifyResult(result Result) string {
+	if result.Success == 1 {
+		return ""
+	}
+	if result.Error != nil {
+		return classifyMessage(result.Error.Error())
+	}
+	return classifyStatus(result.StatusCode)
+}
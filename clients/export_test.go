@@ -0,0 +1,35 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients
+
+import "time"
+
+// NewTestTokenSession returns a token session that tells the time with now.
+func NewTestTokenSession(granter tokenGranter, now func() time.Time) *tokenSession {
+	session := newTokenSession(granter)
+	session.now = now
+	return session
+}
+
+// NewTestBosh returns a BoshImpl without a director that renews the tokens
+// of the session and waits with sleep.
+func NewTestBosh(tokens *tokenSession, sleep func(time.Duration)) *BoshImpl {
+	return &BoshImpl{tokens: tokens, sleepFunc: sleep}
+}
+
+func (b *BoshImpl) Authenticated(request func() error) error {
+	return b.authenticated(request)
+}
@@ -0,0 +1,167 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// jsonlResult is a probe result as a line of the JSON Lines output format.
+type jsonlResult struct {
+	Timestamp   time.Time    `json:"timestamp"`
+	Target      string       `json:"target"`
+	Success     bool         `json:"success"`
+	LatencyMs   float64      `json:"latency_ms"`
+	StatusCode  int          `json:"status_code"`
+	Size        int          `json:"size"`
+	Error       string       `json:"error,omitempty"`
+	ErrorClass  string       `json:"error_class,omitempty"`
+	Annotations []Annotation `json:"annotations,omitempty"`
+}
+
+type jsonlResultWriter struct {
+	encoder *json.Encoder
+	target  string
+}
+
+func (w jsonlResultWriter) Write(result Result, annotations []Annotation) error {
+	return w.encoder.Encode(newJSONLResult(result, w.target, annotations))
+}
+
+func newJSONLResult(result Result, target string, annotations []Annotation) jsonlResult {
+	jsonl := jsonlResult{
+		Timestamp:   result.Timestamp,
+		Target:      target,
+		Success:     result.Success == 1,
+		LatencyMs:   float64(result.ResponseTime) / float64(time.Millisecond),
+		StatusCode:  result.StatusCode,
+		Size:        result.Size,
+		ErrorClass:  result.ErrorClass,
+		Annotations: annotations,
+	}
+	if result.Error != nil {
+		jsonl.Error = result.Error.Error()
+	}
+	return jsonl
+}
+
+func (r jsonlResult) result() Result {
+	result := Result{
+		Timestamp:    r.Timestamp,
+		ResponseTime: time.Duration(r.LatencyMs * float64(time.Millisecond)),
+		StatusCode:   r.StatusCode,
+		Size:         r.Size,
+		ErrorClass:   r.ErrorClass,
+	}
+	if r.Success {
+		result.Success = 1
+	}
+	if r.Error != "" {
+		result.Error = errors.New(r.Error)
+	}
+	if !isErrorClass(result.ErrorClass) {
+		result.ErrorClass = classifyResult(result)
+	}
+	return result
+}
+
+// isJSONL tells a JSON Lines recording from a CSV one by its first byte.
+func isJSONL(input *bufio.Reader) bool {
+	first, err := input.Peek(1)
+	return err == nil && first[0] == '{'
+}
+
+func readJSONLResults(input io.Reader) ([]Result, error) {
+	results := []Result{}
+	err := readJSONL(input, func(line jsonlLine) error {
+		if line.result != nil {
+			results = append(results, line.result.result())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// annotateJSONL copies a JSON Lines recording, replacing the annotations of
+// each result by the ones matching its timestamp.
+func annotateJSONL(input io.Reader, output io.Writer, timestamps DeploymentTimes) error {
+	encoder := json.NewEncoder(output)
+	cursor := timestamps.cursor()
+	return readJSONL(input, func(line jsonlLine) error {
+		if line.outage != nil {
+			return encoder.Encode(line.outage)
+		}
+		line.result.Annotations = cursor.upTo(unixMillis(line.result.Timestamp))
+		return encoder.Encode(line.result)
+	})
+}
+
+// jsonlOutage is an outage as a line of the JSON Lines output format.
+type jsonlOutage struct {
+	Record string `json:"record"`
+	Target string `json:"target"`
+	Outage
+}
+
+func (w jsonlResultWriter) WriteOutage(outage Outage) error {
+	return w.encoder.Encode(jsonlOutage{Record: "outage", Target: w.target, Outage: outage})
+}
+
+// jsonlLine is a line of a JSON Lines recording, either a probe result or
+// an outage record.
+type jsonlLine struct {
+	result *jsonlResult
+	outage *jsonlOutage
+}
+
+func readJSONL(input io.Reader, handle func(jsonlLine) error) error {
+	decoder := json.NewDecoder(input)
+	for number := 1; ; number++ {
+		raw := json.RawMessage{}
+		err := decoder.Decode(&raw)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: %s", number, err)
+		}
+		record := struct {
+			Record string `json:"record"`
+		}{}
+		line := jsonlLine{}
+		if err = json.Unmarshal(raw, &record); err == nil && record.Record == "outage" {
+			line.outage = &jsonlOutage{}
+			err = json.Unmarshal(raw, line.outage)
+		} else if err == nil {
+			line.result = &jsonlResult{}
+			err = json.Unmarshal(raw, line.result)
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: %s", number, err)
+		}
+		if err := handle(line); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,161 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Details string `xml:",chardata"`
+}
+
+// WriteJUnitReport writes the summary of a recording as a JUnit XML test
+// suite for CI servers to show: the target, every SLO and every instance
+// group stage of the deployment is a test case. The target and the stages
+// fail if there was an outage during them, the SLOs if they were breached.
+func WriteJUnitReport(filename, target string, interval time.Duration, summary Summary, slos []SLOResult) error {
+	suite := junitTestSuite{
+		Name: target,
+		Time: junitTime(time.Duration(summary.Probes) * interval),
+	}
+
+	targetCase := junitTestCase{
+		Name:      target,
+		Classname: "downtimer",
+		Time:      suite.Time,
+		SystemOut: summary.String(),
+	}
+	if len(summary.Outages) > 0 {
+		targetCase.Failure = &junitFailure{
+			Message: fmt.Sprintf("%d of %d probes failed, %s downtime", summary.Failures, summary.Probes, summary.Downtime),
+			Type:    "downtime",
+			Details: outageDetails(summary.Outages, time.Time{}, time.Time{}),
+		}
+	}
+	suite.Cases = append(suite.Cases, targetCase)
+
+	for _, slo := range slos {
+		sloCase := junitTestCase{
+			Name:      fmt.Sprintf("SLO %s %s", slo.Name, slo.Objective),
+			Classname: "downtimer.slo",
+			Time:      "0",
+			SystemOut: slo.String(),
+		}
+		if !slo.Met {
+			sloCase.Failure = &junitFailure{
+				Message: slo.String(),
+				Type:    "slo",
+				Details: outageDetails(summary.Outages, time.Time{}, time.Time{}),
+			}
+		}
+		suite.Cases = append(suite.Cases, sloCase)
+	}
+
+	for _, stage := range summary.Stages {
+		if len(stage.Stage.Tags) == 0 {
+			continue
+		}
+		name := stage.Stage.Label()
+		if deployment := deploymentLabel(stage.Stage.Director, stage.Stage.Deployment); deployment != "" {
+			name = deployment + ": " + name
+		}
+		stageCase := junitTestCase{
+			Name:      name,
+			Classname: "downtimer.instance_group",
+			Time:      "0",
+		}
+		if !stage.Stage.End.IsZero() {
+			stageCase.Time = junitTime(stage.Stage.End.Sub(stage.Stage.Start))
+		}
+		if stage.Downtime > 0 {
+			stageCase.Failure = &junitFailure{
+				Message: fmt.Sprintf("%d of %d probes failed, %s downtime", stage.Failures, stage.Probes, stage.Downtime),
+				Type:    "downtime",
+				Details: outageDetails(summary.Outages, stage.Stage.Start, stage.Stage.End),
+			}
+		}
+		suite.Cases = append(suite.Cases, stageCase)
+	}
+
+	suite.Tests = len(suite.Cases)
+	for _, testCase := range suite.Cases {
+		if testCase.Failure != nil {
+			suite.Failures++
+		}
+	}
+
+	report, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	output, err := FS.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer output.Close()
+	_, err = output.Write(append([]byte(xml.Header), append(report, '\n')...))
+	return err
+}
+
+// WriteJUnitReport writes the JUnit report to the --junit file, if given.
+func (p *Prober) WriteJUnitReport(summary Summary, slos []SLOResult) error {
+	if p.opts.JUnitFile == "" {
+		return nil
+	}
+	return WriteJUnitReport(p.opts.JUnitFile, p.url, p.opts.Interval, summary, slos)
+}
+
+// outageDetails lists the outages between start and end, one per line.
+func outageDetails(outages []Outage, start, end time.Time) string {
+	lines := []string{}
+	for _, outage := range outages {
+		if outage.Overlaps(start, end) {
+			lines = append(lines, outage.String())
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func junitTime(duration time.Duration) string {
+	return fmt.Sprintf("%.3f", duration.Seconds())
+}
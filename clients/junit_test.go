@@ -0,0 +1,128 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients_test
+
+import (
+	"encoding/xml"
+	"errors"
+	"time"
+
+	"github.com/pivotal-cf/downtimer/clients"
+	"github.com/spf13/afero"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type junitReport struct {
+	Suites []struct {
+		Name     string `xml:"name,attr"`
+		Tests    int    `xml:"tests,attr"`
+		Failures int    `xml:"failures,attr"`
+		Cases    []struct {
+			Name      string `xml:"name,attr"`
+			Classname string `xml:"classname,attr"`
+			Time      string `xml:"time,attr"`
+			Failure   *struct {
+				Message string `xml:"message,attr"`
+				Details string `xml:",chardata"`
+			} `xml:"failure"`
+		} `xml:"testcase"`
+	} `xml:"testsuite"`
+}
+
+var _ = Describe("JUnit report", func() {
+	start := time.Date(2017, 8, 1, 10, 0, 0, 0, time.UTC)
+	results := []clients.Result{}
+	for i := 0; i < 60; i++ {
+		result := clients.Result{Timestamp: start.Add(time.Duration(i) * time.Second), Success: 1, StatusCode: 200}
+		if i >= 20 && i < 25 {
+			result = clients.Result{Timestamp: result.Timestamp, Error: errors.New("connection refused")}
+		}
+		results = append(results, result)
+	}
+	stages := []clients.Stage{
+		{Name: "Preparing deployment", Start: start, End: start.Add(5 * time.Second)},
+		{Deployment: "cf", Name: "Updating instance", Tags: []string{"router"}, Start: start.Add(15 * time.Second), End: start.Add(30 * time.Second)},
+		{Deployment: "cf", Name: "Updating instance", Tags: []string{"api"}, Start: start.Add(30 * time.Second), End: start.Add(50 * time.Second)},
+	}
+
+	var report junitReport
+	BeforeEach(func() {
+		clients.FS = afero.NewMemMapFs()
+		summary := clients.Summarize(results, stages, time.Second)
+		summary.SetOutages(clients.FindOutages(results, clients.OutagePolicy{Failures: 3, Successes: 3}))
+		slos := clients.CheckSLOs(summary, &clients.Opts{SLOMaxDowntime: 10 * time.Second, SLOMinAvailability: 99})
+		Expect(clients.WriteJUnitReport("/junit.xml", "https://app.example.com", time.Second, summary, slos)).To(Succeed())
+
+		contents, err := afero.ReadFile(clients.FS, "/junit.xml")
+		Expect(err).NotTo(HaveOccurred())
+		report = junitReport{}
+		Expect(xml.Unmarshal(contents, &report)).To(Succeed())
+	})
+
+	It("has a test case for the target, every SLO and every instance group", func() {
+		Expect(report.Suites).To(HaveLen(1))
+		suite := report.Suites[0]
+		Expect(suite.Name).To(Equal("https://app.example.com"))
+		Expect(suite.Tests).To(Equal(5))
+		Expect(suite.Failures).To(Equal(3))
+
+		names := []string{}
+		for _, testCase := range suite.Cases {
+			names = append(names, testCase.Name)
+		}
+		Expect(names).To(Equal([]string{
+			"https://app.example.com",
+			"SLO max downtime 10s",
+			"SLO min availability 99.000%",
+			"cf: Updating instance router",
+			"cf: Updating instance api",
+		}))
+		Expect(suite.Cases[0].Time).To(Equal("60.000"))
+		Expect(suite.Cases[3].Time).To(Equal("15.000"))
+	})
+
+	It("reports breaches as failures with the outages", func() {
+		cases := report.Suites[0].Cases
+		Expect(cases[0].Failure).NotTo(BeNil())
+		Expect(cases[0].Failure.Message).To(Equal("5 of 60 probes failed, 5s downtime"))
+		Expect(cases[0].Failure.Details).To(Equal("down from 10:00:20 to 10:00:25 (5s, 5 failed probes): connection refused"))
+
+		Expect(cases[1].Failure).To(BeNil())
+		Expect(cases[2].Failure).NotTo(BeNil())
+		Expect(cases[2].Failure.Message).To(Equal("SLO min availability 99.000%: 91.525%, breached"))
+
+		Expect(cases[3].Failure).NotTo(BeNil())
+		Expect(cases[3].Failure.Message).To(Equal("5 of 16 probes failed, 5s downtime"))
+		Expect(cases[3].Failure.Details).To(ContainSubstring("down from 10:00:20"))
+		Expect(cases[4].Failure).To(BeNil())
+	})
+
+	It("doesn't fail for probes dropped outside of outages", func() {
+		dropped := append([]clients.Result{}, results[:20]...)
+		dropped[10] = clients.Result{Timestamp: dropped[10].Timestamp, Error: errors.New("connection reset by peer")}
+		summary := clients.Summarize(dropped, stages, time.Second)
+		summary.SetOutages(clients.FindOutages(dropped, clients.OutagePolicy{Failures: 3, Successes: 3}))
+		Expect(clients.WriteJUnitReport("/junit.xml", "https://app.example.com", time.Second, summary, nil)).To(Succeed())
+
+		contents, err := afero.ReadFile(clients.FS, "/junit.xml")
+		Expect(err).NotTo(HaveOccurred())
+		report = junitReport{}
+		Expect(xml.Unmarshal(contents, &report)).To(Succeed())
+		Expect(report.Suites[0].Failures).To(Equal(0))
+	})
+})
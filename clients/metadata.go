@@ -0,0 +1,63 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"time"
+)
+
+// Metadata describes a recording. It is stored next to the CSV file.
+type Metadata struct {
+	URL      string        `json:"url"`
+	Interval time.Duration `json:"interval"`
+	Tasks    []TaskResult  `json:"tasks,omitempty"`
+	Windows  Windows       `json:"windows"`
+}
+
+func MetadataFile(outputFile string) string {
+	return outputFile + ".json"
+}
+
+func WriteMetadata(outputFile string, metadata Metadata) error {
+	metadataBytes, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+	file, err := FS.Create(MetadataFile(outputFile))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(metadataBytes)
+	return err
+}
+
+func ReadMetadata(outputFile string) (Metadata, error) {
+	metadata := Metadata{}
+	file, err := FS.Open(MetadataFile(outputFile))
+	if err != nil {
+		return metadata, err
+	}
+	defer file.Close()
+	metadataBytes, err := ioutil.ReadAll(file)
+	if err != nil {
+		return metadata, err
+	}
+	err = json.Unmarshal(metadataBytes, &metadata)
+	return metadata, err
+}
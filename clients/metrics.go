@@ -0,0 +1,245 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds of the latency histogram in seconds.
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics exposes the probe results and the instance groups being updated
+// in the Prometheus text format while recording, labelled by target.
+type Metrics struct {
+	lock     sync.Mutex
+	policy   OutagePolicy
+	targets  map[string]*targetMetrics
+	updating map[instanceGroup]int
+}
+
+type targetMetrics struct {
+	successes  int
+	failures   int
+	up         bool
+	outages    *outageDetector
+	last       Result
+	downtime   time.Duration
+	buckets    []int
+	latencySum time.Duration
+}
+
+type instanceGroup struct {
+	target     string
+	director   string
+	deployment string
+	name       string
+}
+
+// NewMetrics returns metrics that find outages with the policy.
+func NewMetrics(policy OutagePolicy) *Metrics {
+	return &Metrics{policy: policy, targets: map[string]*targetMetrics{}, updating: map[instanceGroup]int{}}
+}
+
+// Observe counts a probe result. The downtime is the time spent in outages,
+// as in the summary, including the one going on.
+func (m *Metrics) Observe(target string, result Result) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	metrics := m.target(target)
+	metrics.up = result.Success == 1
+	metrics.last = result
+	if _, ended := metrics.outages.observe(result); ended != nil {
+		metrics.downtime += ended.Duration()
+	}
+	if !metrics.up {
+		metrics.failures++
+		return
+	}
+	metrics.successes++
+	metrics.latencySum += result.ResponseTime
+	for i, bound := range latencyBuckets {
+		if result.ResponseTime.Seconds() <= bound {
+			metrics.buckets[i]++
+		}
+	}
+}
+
+// Annotate follows the instance updates among the director events.
+func (m *Metrics) Annotate(target string, annotations []Annotation) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, annotation := range annotations {
+		if annotation.ObjectType != "instance" || annotation.ObjectName == "" {
+			continue
+		}
+		group := instanceGroup{
+			target:     target,
+			director:   annotation.Director,
+			deployment: annotation.Deployment,
+			name:       strings.SplitN(annotation.ObjectName, "/", 2)[0],
+		}
+		switch annotation.Phase {
+		case "start":
+			m.updating[group]++
+		case "done":
+			if m.updating[group]--; m.updating[group] <= 0 {
+				delete(m.updating, group)
+			}
+		}
+	}
+}
+
+// Sink feeds the metrics with a recording of the target.
+func (m *Metrics) Sink(target string) Sink {
+	return metricsSink{metrics: m, target: target}
+}
+
+type metricsSink struct {
+	metrics *Metrics
+	target  string
+}
+
+func (s metricsSink) Annotate(annotations []Annotation) error {
+	s.metrics.Annotate(s.target, annotations)
+	return nil
+}
+
+func (s metricsSink) Result(result Result) error {
+	s.metrics.Observe(s.target, result)
+	return nil
+}
+
+func (s metricsSink) Close() error {
+	return nil
+}
+
+func (m *Metrics) target(target string) *targetMetrics {
+	metrics, ok := m.targets[target]
+	if !ok {
+		metrics = &targetMetrics{outages: newOutageDetector(m.policy), buckets: make([]int, len(latencyBuckets))}
+		m.targets[target] = metrics
+	}
+	return metrics
+}
+
+// totalDowntime is the time of the outages that ended and of the one going
+// on.
+func (t *targetMetrics) totalDowntime() time.Duration {
+	if outage := t.outages.ongoing(t.last); outage != nil {
+		return t.downtime + outage.Duration()
+	}
+	return t.downtime
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.write(w)
+}
+
+// write writes the metrics in the Prometheus text format.
+func (m *Metrics) write(w io.Writer) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	targets := []string{}
+	for target := range m.targets {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	family := func(name, kind, help string, sample func(target string, metrics *targetMetrics)) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		for _, target := range targets {
+			sample(target, m.targets[target])
+		}
+	}
+	family("downtimer_probe_successes_total", "counter", "Successful probes.", func(target string, metrics *targetMetrics) {
+		fmt.Fprintf(w, "downtimer_probe_successes_total%s %d\n", labels("target", target), metrics.successes)
+	})
+	family("downtimer_probe_failures_total", "counter", "Failed probes.", func(target string, metrics *targetMetrics) {
+		fmt.Fprintf(w, "downtimer_probe_failures_total%s %d\n", labels("target", target), metrics.failures)
+	})
+	family("downtimer_up", "gauge", "Whether the last probe succeeded.", func(target string, metrics *targetMetrics) {
+		up := 0
+		if metrics.up {
+			up = 1
+		}
+		fmt.Fprintf(w, "downtimer_up%s %d\n", labels("target", target), up)
+	})
+	family("downtimer_downtime_seconds_total", "counter", "Time spent in outages.", func(target string, metrics *targetMetrics) {
+		fmt.Fprintf(w, "downtimer_downtime_seconds_total%s %g\n", labels("target", target), metrics.totalDowntime().Seconds())
+	})
+	family("downtimer_probe_latency_seconds", "histogram", "Latency of successful probes.", func(target string, metrics *targetMetrics) {
+		for i, bound := range latencyBuckets {
+			fmt.Fprintf(w, "downtimer_probe_latency_seconds_bucket%s %d\n", labels("target", target, "le", fmt.Sprint(bound)), metrics.buckets[i])
+		}
+		fmt.Fprintf(w, "downtimer_probe_latency_seconds_bucket%s %d\n", labels("target", target, "le", "+Inf"), metrics.successes)
+		fmt.Fprintf(w, "downtimer_probe_latency_seconds_sum%s %g\n", labels("target", target), metrics.latencySum.Seconds())
+		fmt.Fprintf(w, "downtimer_probe_latency_seconds_count%s %d\n", labels("target", target), metrics.successes)
+	})
+
+	groups := []instanceGroup{}
+	for group := range m.updating {
+		groups = append(groups, group)
+	}
+	sort.Sort(instanceGroups(groups))
+	fmt.Fprint(w, "# HELP downtimer_updating_instance_group Instances of the group being updated by BOSH.\n# TYPE downtimer_updating_instance_group gauge\n")
+	for _, group := range groups {
+		fmt.Fprintf(w, "downtimer_updating_instance_group%s %d\n",
+			labels("target", group.target, "director", group.director, "deployment", group.deployment, "instance_group", group.name),
+			m.updating[group])
+	}
+}
+
+type instanceGroups []instanceGroup
+
+func (g instanceGroups) Len() int      { return len(g) }
+func (g instanceGroups) Swap(i, j int) { g[i], g[j] = g[j], g[i] }
+func (g instanceGroups) Less(i, j int) bool {
+	return fmt.Sprint(g[i]) < fmt.Sprint(g[j])
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels formats name and value pairs as Prometheus labels.
+func labels(pairs ...string) string {
+	formatted := []string{}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		formatted = append(formatted, fmt.Sprintf(`%s="%s"`, pairs[i], labelEscaper.Replace(pairs[i+1])))
+	}
+	return "{" + strings.Join(formatted, ",") + "}"
+}
+
+// ServeMetrics serves the metrics at /metrics on the address until the
+// process exits.
+func ServeMetrics(address string, metrics *Metrics) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	go http.Serve(listener, mux)
+	return nil
+}
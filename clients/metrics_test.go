@@ -0,0 +1,87 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients_test
+
+import (
+	"errors"
+	"net/http/httptest"
+	"time"
+
+	"github.com/pivotal-cf/downtimer/clients"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Metrics", func() {
+	var metrics *clients.Metrics
+
+	BeforeEach(func() {
+		metrics = clients.NewMetrics(clients.OutagePolicy{Failures: 2, Successes: 1})
+	})
+
+	scrape := func() string {
+		recorder := httptest.NewRecorder()
+		metrics.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+		return recorder.Body.String()
+	}
+
+	It("counts probes, latency and downtime by target", func() {
+		metrics.Observe("http://app", clients.Result{Timestamp: time.Unix(0, 0), Success: 1, ResponseTime: 20 * time.Millisecond})
+		metrics.Observe("http://app", clients.Result{Timestamp: time.Unix(1, 0), Success: 1, ResponseTime: 300 * time.Millisecond})
+		metrics.Observe("http://app", clients.Result{Timestamp: time.Unix(2, 0), Success: 0, Error: errors.New("connection refused")})
+		metrics.Observe("http://app", clients.Result{Timestamp: time.Unix(3, 0), Success: 0, Error: errors.New("connection refused")})
+		metrics.Observe("http://app", clients.Result{Timestamp: time.Unix(4, 0), Success: 0, Error: errors.New("connection refused")})
+
+		exposition := scrape()
+		Expect(exposition).To(ContainSubstring("# TYPE downtimer_probe_successes_total counter\n"))
+		Expect(exposition).To(ContainSubstring(`downtimer_probe_successes_total{target="http://app"} 2` + "\n"))
+		Expect(exposition).To(ContainSubstring(`downtimer_probe_failures_total{target="http://app"} 3` + "\n"))
+		Expect(exposition).To(ContainSubstring(`downtimer_up{target="http://app"} 0` + "\n"))
+		Expect(exposition).To(ContainSubstring(`downtimer_downtime_seconds_total{target="http://app"} 2` + "\n"))
+		Expect(exposition).To(ContainSubstring(`downtimer_probe_latency_seconds_bucket{target="http://app",le="0.025"} 1` + "\n"))
+		Expect(exposition).To(ContainSubstring(`downtimer_probe_latency_seconds_bucket{target="http://app",le="0.5"} 2` + "\n"))
+		Expect(exposition).To(ContainSubstring(`downtimer_probe_latency_seconds_bucket{target="http://app",le="+Inf"} 2` + "\n"))
+		Expect(exposition).To(ContainSubstring(`downtimer_probe_latency_seconds_sum{target="http://app"} 0.32` + "\n"))
+		Expect(exposition).To(ContainSubstring(`downtimer_probe_latency_seconds_count{target="http://app"} 2` + "\n"))
+	})
+
+	It("takes the downtime from the outages, not from single failed probes", func() {
+		for i, success := range []int{1, 0, 1, 0, 0, 0, 1, 1} {
+			metrics.Observe("http://app", clients.Result{Timestamp: time.Unix(int64(i), 0), Success: success})
+		}
+		Expect(scrape()).To(ContainSubstring(`downtimer_downtime_seconds_total{target="http://app"} 3` + "\n"))
+	})
+
+	It("shows the instance groups being updated", func() {
+		metrics.Annotate("http://app", []clients.Annotation{
+			{Deployment: "cf", Action: "update", ObjectType: "instance", ObjectName: "router/0", Phase: "start"},
+			{Deployment: "cf", Action: "update", ObjectType: "instance", ObjectName: "diego-cell/1", Phase: "start"},
+			{Deployment: "cf", Action: "update", ObjectType: "instance", ObjectName: "router/0", Phase: "done"},
+			{Deployment: "cf", Action: "delete", ObjectType: "vm", ObjectName: "vm-1234", Phase: "start"},
+		})
+
+		exposition := scrape()
+		Expect(exposition).To(ContainSubstring(`downtimer_updating_instance_group{target="http://app",director="",deployment="cf",instance_group="diego-cell"} 1` + "\n"))
+		Expect(exposition).NotTo(ContainSubstring(`instance_group="router"`))
+		Expect(exposition).NotTo(ContainSubstring("vm-1234"))
+	})
+
+	It("escapes label values", func() {
+		metrics.Observe(`http://app/"quoted"`, clients.Result{Success: 1})
+		Expect(scrape()).To(ContainSubstring(`downtimer_up{target="http://app/\"quoted\""} 1`))
+	})
+})
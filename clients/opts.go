@@ -15,18 +15,121 @@ limitations under the License. */
 
 package clients
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"time"
+)
 
+// Opts are set from the command line and, for the options with a config key,
+// from the --config file.
 type Opts struct {
-	URL                string        `short:"u" long:"url" description:"URL to probe" required:"true"`
-	Duration           time.Duration `short:"d" long:"duration" description:"How long to probe for, forever by default" default:"0s"`
-	Interval           time.Duration `short:"i" long:"interval" description:"interval at which to probe" default:"1s"`
-	BoshCACert         string        `short:"c" long:"ca-cert" description:"CA cert for bosh" group:"bosh"`
-	OutputFile         string        `short:"o" long:"output" description:"destination for CSV rows" default:"/dev/stdout"`
-	LogFile            string        `short:"l" long:"logfile" description:"logfile" default:"/dev/stderr"`
-	BoshHost           string        `short:"b" long:"bosh" description:"bosh host" group:"bosh"`
-	BoshUser           string        `short:"U" long:"user" description:"bosh user" group:"bosh"`
-	BoshPassword       string        `short:"P" long:"password" description:"bosh client password" group:"bosh"`
-	BoshTask           string        `short:"T" long:"task" description:"bosh deployment task override" group:"bosh"`
-	InsecureSkipVerify bool          `short:"k" long:"skip-ssl-validation" description:"skip SSL validation"`
+	Config             string        `long:"config" description:"YAML or JSON file with settings, overridden by flags; ${VAR} is replaced from the environment"`
+	URL                string        `short:"u" long:"url" description:"URL to probe" config:"target.url"`
+	Duration           time.Duration `short:"d" long:"duration" description:"How long to probe for, forever by default" default:"0s" config:"recording.duration"`
+	Interval           time.Duration `short:"i" long:"interval" description:"interval at which to probe" default:"1s" config:"target.interval"`
+	Timeout            time.Duration `long:"timeout" description:"how long a probe may take before it fails" default:"10s" config:"target.timeout"`
+	ExpectStatus       []int         `long:"expect-status" description:"response status of a successful probe, can be repeated" default:"200" config:"success.status"`
+	ExpectBody         string        `long:"expect-body" description:"regular expression the response body of a successful probe matches" config:"success.body"`
+	BoshCACert         string        `short:"c" long:"ca-cert" description:"CA cert for bosh, as a file or PEM" group:"bosh" config:"bosh.ca_cert"`
+	OutputFile         string        `short:"o" long:"output" description:"destination for the probe results" default:"/dev/stdout" config:"output.file"`
+	Format             string        `long:"format" description:"format of the output file" choice:"csv" choice:"jsonl" default:"csv" config:"output.format"`
+	Sinks              []string      `long:"sink" description:"also write the results as format:destination, e.g. jsonl:recording.jsonl or pretty for stderr, can be repeated" config:"output.sinks"`
+	Append             bool          `long:"append" description:"append to an existing output file instead of overwriting it, e.g. after a restart" config:"output.append"`
+	LogFile            string        `short:"l" long:"logfile" description:"logfile" default:"/dev/stderr" config:"output.log"`
+	BoshHost           string        `short:"b" long:"bosh" description:"bosh director URL, host[:port] or alias from the bosh CLI config" group:"bosh" config:"bosh.environment"`
+	BoshUser           string        `short:"U" long:"user" description:"bosh user" group:"bosh" config:"bosh.client"`
+	BoshPassword       string        `short:"P" long:"password" description:"bosh client password" group:"bosh" config:"bosh.client_secret"`
+	BoshFromEnv        bool          `long:"bosh-from-env" description:"take the bosh options not given from BOSH_ENVIRONMENT, BOSH_CLIENT, BOSH_CLIENT_SECRET and BOSH_CA_CERT like the bosh CLI" group:"bosh" config:"bosh.from_env"`
+	BoshTask           string        `short:"T" long:"task" description:"bosh deployment task override" group:"bosh" config:"bosh.task"`
+	BoshEvents         []string      `short:"e" long:"events" description:"bosh events to annotate as action/object-type, e.g. update/instance or */vm, all by default" group:"bosh" config:"bosh.events"`
+	BoshEventInterval  time.Duration `long:"event-interval" description:"how often to fetch new bosh events while recording, 0 to only annotate at the end" default:"10s" group:"bosh" config:"bosh.event_interval"`
+	Baseline           time.Duration `long:"baseline" description:"probe this long before the deployment starts as a baseline" default:"0s" config:"recording.baseline"`
+	Tail               time.Duration `long:"tail" description:"keep probing this long after the deployment ended" default:"0s" config:"recording.tail"`
+	FailureGracePeriod time.Duration `long:"failure-grace-period" description:"keep probing this long after the bosh task failed or was cancelled" default:"0s" group:"bosh" config:"recording.failure_grace_period"`
+	BoshPollInterval   time.Duration `long:"bosh-poll-interval" description:"how often to check the director for deployment tasks" default:"5s" group:"bosh" config:"bosh.poll_interval"`
+	BoshPollJitter     float64       `long:"bosh-poll-jitter" description:"randomly vary the bosh poll interval by up to this fraction" default:"0.1" group:"bosh" config:"bosh.poll_jitter"`
+	BoshPollMaxBackoff time.Duration `long:"bosh-poll-max-backoff" description:"longest delay between bosh polls while the director returns errors" default:"2m" group:"bosh" config:"bosh.poll_max_backoff"`
+	Deployments        []string      `long:"deployment" description:"deployment to record as [director/]deployment, can be repeated; in daemon mode all by default" group:"bosh" config:"bosh.deployments"`
+	Until              string        `long:"until" description:"with several deployments, record until all or any of their tasks finished" choice:"all" choice:"any" default:"all" group:"bosh" config:"bosh.until"`
+	MetricsAddress     string        `long:"metrics-address" description:"serve Prometheus metrics at /metrics on this address, e.g. :9100, while recording" config:"output.metrics_address"`
+	JUnitFile          string        `long:"junit" description:"write a JUnit XML report of the recording to this file for CI; in daemon mode, any value writes <deployment>-<task>.xml to the output dir" config:"output.junit"`
+	OutputDir          string        `long:"output-dir" description:"destination for the CSV files of daemon mode, named after deployment and task" default:"." config:"output.dir"`
+	OutageFailures     int           `long:"outage-failures" description:"consecutive failed probes that make an outage" default:"3" config:"outage.failures"`
+	OutageSuccesses    int           `long:"outage-successes" description:"consecutive successful probes that end an outage" default:"3" config:"outage.successes"`
+	OutageWindow       time.Duration `long:"outage-window" description:"also start an outage with --outage-window-failures failed probes within this long, 0 to only count consecutive ones" default:"0s" config:"outage.window"`
+	OutageWindowCount  int           `long:"outage-window-failures" description:"failed probes within --outage-window that make an outage" default:"5" config:"outage.window_failures"`
+	WebhookURL         string        `long:"webhook" description:"URL to POST to when an outage starts and ends" config:"webhook.url"`
+	WebhookTemplate    string        `long:"webhook-template" description:"Go template of the JSON payload, a Slack message by default; see README" config:"webhook.template"`
+	WebhookMinInterval time.Duration `long:"webhook-min-interval" description:"post at most this often, combining the notifications in between" default:"30s" config:"webhook.min_interval"`
+	SLOMaxDowntime     time.Duration `long:"slo-max-downtime" description:"fail if the app was down for longer" config:"slo.max_downtime"`
+	SLOMinAvailability float64       `long:"slo-min-availability" description:"fail if fewer percent of the probes succeeded" config:"slo.min_availability"`
+	SLOMaxP95Latency   time.Duration `long:"slo-max-p95-latency" description:"fail if the 95th percentile latency of successful probes was higher" config:"slo.max_p95_latency"`
+	CompareThreshold   time.Duration `long:"max-downtime-increase" description:"with compare, fail if the new recording has more downtime than the old one by more than this" config:"compare.max_downtime_increase"`
+	InsecureSkipVerify bool          `short:"k" long:"skip-ssl-validation" description:"skip SSL validation" config:"target.skip_ssl_validation"`
+}
+
+// ReadBoshEnv fills in the bosh options that aren't given from the
+// environment variables of the bosh CLI, with --bosh-from-env only, so that
+// a bosh CLI session in the shell doesn't switch to recording a deployment.
+func (o *Opts) ReadBoshEnv() {
+	if !o.BoshFromEnv {
+		return
+	}
+	for option, variable := range map[*string]string{
+		&o.BoshHost:     "BOSH_ENVIRONMENT",
+		&o.BoshUser:     "BOSH_CLIENT",
+		&o.BoshPassword: "BOSH_CLIENT_SECRET",
+		&o.BoshCACert:   "BOSH_CA_CERT",
+	} {
+		if *option == "" {
+			*option = os.Getenv(variable)
+		}
+	}
+}
+
+// Validate checks the options that can't be checked while parsing them.
+func (o *Opts) Validate() error {
+	if o.URL == "" {
+		return errors.New("the required flag `-u, --url' was not specified")
+	}
+	target, err := url.Parse(o.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("the URL to probe must be an http or https URL: %s", o.URL)
+	}
+	if o.Interval <= 0 {
+		return errors.New("the probe interval must be positive")
+	}
+	if o.BoshPollInterval <= 0 {
+		return errors.New("the bosh poll interval must be positive")
+	}
+	if _, err := regexp.Compile(o.ExpectBody); err != nil {
+		return fmt.Errorf("invalid expected body: %s", err)
+	}
+	for _, status := range o.ExpectStatus {
+		if status < 100 || status > 599 {
+			return fmt.Errorf("invalid expected status: %d", status)
+		}
+	}
+	for _, sink := range o.Sinks {
+		if _, _, err := ParseSink(sink); err != nil {
+			return err
+		}
+	}
+	if o.OutageFailures < 1 || o.OutageSuccesses < 1 {
+		return errors.New("outages need at least one failed and one successful probe")
+	}
+	if o.OutageWindow < 0 || (o.OutageWindow > 0 && o.OutageWindowCount < 1) {
+		return errors.New("the outage window needs a positive length and number of failed probes")
+	}
+	if _, err := ParseWebhookTemplate(o.WebhookTemplate); err != nil {
+		return fmt.Errorf("invalid webhook template: %s", err)
+	}
+	if o.SLOMinAvailability < 0 || o.SLOMinAvailability > 100 {
+		return errors.New("the minimum availability must be a percentage")
+	}
+	return nil
 }
@@ -0,0 +1,223 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Outage is a time the target was down, from the first failed probe until
+// the first successful one after it. An outage is flapping if the target
+// kept coming back during it: it was opened by failures within the outage
+// window rather than in a row, or probes succeeded in between without
+// ending it. An outage the recording ended in is ongoing and ends with the
+// last probe.
+type Outage struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Failures int       `json:"failures"`
+	Flaps    int       `json:"flaps,omitempty"`
+	Flapping bool      `json:"flapping,omitempty"`
+	Ongoing  bool      `json:"ongoing,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+func (o Outage) Duration() time.Duration {
+	return o.End.Sub(o.Start)
+}
+
+// OutagePolicy tells outages apart from single dropped probes: an outage
+// starts with Failures failed probes in a row, or with WindowFailures
+// failed probes within Window if that is set, and ends with Successes
+// successful probes in a row.
+type OutagePolicy struct {
+	Failures       int
+	WindowFailures int
+	Window         time.Duration
+	Successes      int
+}
+
+func (o *Opts) OutagePolicy() OutagePolicy {
+	return OutagePolicy{
+		Failures:       o.OutageFailures,
+		WindowFailures: o.OutageWindowCount,
+		Window:         o.OutageWindow,
+		Successes:      o.OutageSuccesses,
+	}
+}
+
+type outageDetector struct {
+	policy    OutagePolicy
+	failed    []Result
+	recent    []Result
+	recovered []Result
+	outage    *Outage
+}
+
+func newOutageDetector(policy OutagePolicy) *outageDetector {
+	if policy.Failures < 1 {
+		policy.Failures = 1
+	}
+	if policy.Successes < 1 {
+		policy.Successes = 1
+	}
+	return &outageDetector{policy: policy}
+}
+
+// observe returns the outage that started or ended with the result, if any.
+func (d *outageDetector) observe(result Result) (started *Outage, ended *Outage) {
+	if result.Success == 0 {
+		if d.outage != nil {
+			d.outage.Failures++
+			if len(d.recovered) > 0 {
+				d.outage.Flaps++
+				d.recovered = nil
+			}
+			return nil, nil
+		}
+		d.failed = append(d.failed, result)
+		d.recent = append(d.recent, result)
+		for len(d.recent) > 0 && result.Timestamp.Sub(d.recent[0].Timestamp) > d.policy.Window {
+			d.recent = d.recent[1:]
+		}
+		switch {
+		case len(d.failed) >= d.policy.Failures:
+			d.outage = &Outage{Start: d.failed[0].Timestamp, Failures: len(d.failed), Error: resultError(d.failed[0])}
+		case d.policy.Window > 0 && d.policy.WindowFailures > 0 && len(d.recent) >= d.policy.WindowFailures:
+			d.outage = &Outage{Start: d.recent[0].Timestamp, Failures: len(d.recent), Flapping: true, Error: resultError(d.recent[0])}
+		default:
+			return nil, nil
+		}
+		d.failed, d.recent = nil, nil
+		outage := *d.outage
+		return &outage, nil
+	}
+
+	d.failed = nil
+	if d.outage == nil {
+		return nil, nil
+	}
+	d.recovered = append(d.recovered, result)
+	if len(d.recovered) < d.policy.Successes {
+		return nil, nil
+	}
+	d.outage.End = d.recovered[0].Timestamp
+	d.outage.Flapping = d.outage.Flapping || d.outage.Flaps > 0
+	outage := *d.outage
+	d.outage, d.recovered = nil, nil
+	return nil, &outage
+}
+
+// ongoing returns the outage still going on when the recording ended with
+// the given result.
+func (d *outageDetector) ongoing(last Result) *Outage {
+	if d.outage == nil {
+		return nil
+	}
+	outage := *d.outage
+	outage.End = last.Timestamp
+	outage.Flapping = outage.Flapping || outage.Flaps > 0
+	outage.Ongoing = true
+	return &outage
+}
+
+func resultError(result Result) string {
+	if result.Error != nil {
+		return result.Error.Error()
+	}
+	if result.StatusCode != 0 {
+		return "status " + strconv.Itoa(result.StatusCode)
+	}
+	return ""
+}
+
+// FindOutages returns the outages of a recording.
+func FindOutages(results []Result, policy OutagePolicy) []Outage {
+	detector := newOutageDetector(policy)
+	outages := []Outage{}
+	for _, result := range results {
+		if _, ended := detector.observe(result); ended != nil {
+			outages = append(outages, *ended)
+		}
+	}
+	if len(results) > 0 {
+		if outage := detector.ongoing(results[len(results)-1]); outage != nil {
+			outages = append(outages, *outage)
+		}
+	}
+	return outages
+}
+
+// Overlaps reports whether the outage was at least partly between start
+// and end. A zero end is open ended.
+func (o Outage) Overlaps(start, end time.Time) bool {
+	return !o.End.Before(start) && (end.IsZero() || !o.Start.After(end))
+}
+
+// overlap is how long the outage lasted between start and end, with a zero
+// end for no end.
+func (o Outage) overlap(start, end time.Time) time.Duration {
+	return overlap(o.Start, o.End, start, end)
+}
+
+// overlap is how much of the time from from to to was between start and
+// end, with a zero end for no end.
+func overlap(from, to, start, end time.Time) time.Duration {
+	if from.Before(start) {
+		from = start
+	}
+	if !end.IsZero() && to.After(end) {
+		to = end
+	}
+	if !to.After(from) {
+		return 0
+	}
+	return to.Sub(from)
+}
+
+// contains reports whether the target was down at t during the outage.
+func (o Outage) contains(t time.Time) bool {
+	return !t.Before(o.Start) && t.Before(o.End)
+}
+
+func (o Outage) String() string {
+	details := []string{o.Duration().String(), fmt.Sprintf("%d failed probes", o.Failures)}
+	if o.Flapping {
+		details = append(details, "flapping")
+	}
+	if o.Ongoing {
+		details = append(details, "ongoing")
+	}
+	text := fmt.Sprintf("down from %s to %s (%s)", o.Start.Format("15:04:05"), o.End.Format("15:04:05"), strings.Join(details, ", "))
+	if o.Error != "" {
+		text += ": " + o.Error
+	}
+	return text
+}
+
+// AddOutages annotates the start and end of the outages, as they are in
+// CSV recordings.
+func (d DeploymentTimes) AddOutages(outages []Outage) {
+	for _, outage := range outages {
+		d.add(unixMillis(outage.Start), Annotation{ObjectType: "outage", Phase: "start", Error: outage.Error})
+		if !outage.Ongoing {
+			d.add(unixMillis(outage.End), Annotation{ObjectType: "outage", Phase: "done"})
+		}
+	}
+}
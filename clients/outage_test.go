@@ -0,0 +1,166 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/pivotal-cf/downtimer/clients"
+	"github.com/pivotal-cf/downtimer/clients/clientsfakes"
+	"github.com/spf13/afero"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FindOutages", func() {
+	start := time.Date(2017, 8, 1, 10, 0, 0, 0, time.UTC)
+	probes := func(successes ...int) []clients.Result {
+		results := []clients.Result{}
+		for i, success := range successes {
+			results = append(results, clients.Result{Timestamp: start.Add(time.Duration(i) * time.Second), Success: success})
+		}
+		return results
+	}
+	policy := clients.OutagePolicy{Failures: 2, Successes: 2}
+
+	It("ignores failures too short to be an outage", func() {
+		Expect(clients.FindOutages(probes(1, 0, 0, 1, 1, 1), clients.OutagePolicy{Failures: 3, Successes: 3})).To(BeEmpty())
+	})
+
+	It("ends an outage with enough successful probes in a row", func() {
+		outages := clients.FindOutages(probes(0, 0, 0, 1, 1, 0), policy)
+		Expect(outages).To(HaveLen(1))
+		Expect(outages[0].Start).To(Equal(start))
+		Expect(outages[0].End).To(Equal(start.Add(3 * time.Second)))
+		Expect(outages[0].Failures).To(Equal(3))
+		Expect(outages[0].Flapping).To(BeFalse())
+	})
+
+	It("flags an outage the target kept coming back during as flapping", func() {
+		outages := clients.FindOutages(probes(0, 0, 1, 0, 1, 0, 1, 1, 1), policy)
+		Expect(outages).To(HaveLen(1))
+		Expect(outages[0].End).To(Equal(start.Add(6 * time.Second)))
+		Expect(outages[0].Failures).To(Equal(4))
+		Expect(outages[0].Flaps).To(Equal(2))
+		Expect(outages[0].Flapping).To(BeTrue())
+	})
+
+	It("starts a flapping outage with enough failures within the window", func() {
+		windowed := clients.OutagePolicy{Failures: 3, WindowFailures: 3, Window: 4 * time.Second, Successes: 2}
+		Expect(clients.FindOutages(probes(0, 1, 1, 1, 0, 1, 1, 1, 0, 1, 1), windowed)).To(BeEmpty())
+
+		outages := clients.FindOutages(probes(1, 0, 1, 0, 1, 0, 1, 1, 1), windowed)
+		Expect(outages).To(HaveLen(1))
+		Expect(outages[0].Start).To(Equal(start.Add(time.Second)))
+		Expect(outages[0].End).To(Equal(start.Add(6 * time.Second)))
+		Expect(outages[0].Failures).To(Equal(3))
+		Expect(outages[0].Flapping).To(BeTrue())
+	})
+
+	It("ends an ongoing outage with the recording", func() {
+		outages := clients.FindOutages(probes(1, 0, 0, 0), policy)
+		Expect(outages).To(HaveLen(1))
+		Expect(outages[0].Duration()).To(Equal(2 * time.Second))
+		Expect(outages[0].Ongoing).To(BeTrue())
+		Expect(outages[0].String()).To(Equal("down from 10:00:01 to 10:00:03 (2s, 3 failed probes, ongoing)"))
+	})
+})
+
+var _ = Describe("Recording outages", func() {
+	var opts clients.Opts
+	var target *httptest.Server
+
+	BeforeEach(func() {
+		clients.FS = afero.NewMemMapFs()
+		downUntil := time.Now().Add(100 * time.Millisecond)
+		target = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if time.Now().Before(downUntil) {
+				http.Error(w, "Bad Gateway", http.StatusBadGateway)
+			}
+		}))
+		opts = clients.Opts{
+			URL:             target.URL,
+			OutputFile:      "/output.jsonl",
+			Format:          clients.FormatJSONL,
+			Sinks:           []string{"csv:/output.csv", "pretty:/pretty.txt"},
+			Duration:        300 * time.Millisecond,
+			Interval:        10 * time.Millisecond,
+			OutageFailures:  2,
+			OutageSuccesses: 2,
+		}
+	})
+
+	AfterEach(func() {
+		target.Close()
+	})
+
+	It("writes the outages as records of their own", func() {
+		Expect(clients.NewProber(&opts, new(clientsfakes.FakeBosh)).RecordDowntime()).To(Succeed())
+
+		recording, err := afero.ReadFile(clients.FS, "/output.jsonl")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(recording)).To(MatchRegexp(`(?m)^{"record":"outage","target":"http://[^"]+","start":"[^"]+","end":"[^"]+","failures":\d+,"error":"status 502"}$`))
+		results, err := clients.ReadResults("/output.jsonl")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(results).To(HaveLen(strings.Count(string(recording), "\n") - 1))
+
+		outages, err := clients.ReadOutages("/output.jsonl", clients.OutagePolicy{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(outages).To(HaveLen(1))
+		Expect(outages[0].Start).To(BeTemporally("==", results[0].Timestamp))
+		fromCsv, err := clients.ReadOutages("/output.csv", opts.OutagePolicy())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fromCsv).To(HaveLen(1))
+		Expect(fromCsv[0].End).To(BeTemporally("~", outages[0].End, time.Millisecond))
+
+		csv, err := afero.ReadFile(clients.FS, "/output.csv")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(csv)).To(ContainSubstring(",outage start: status 502\n"))
+		Expect(string(csv)).To(ContainSubstring(",outage done\n"))
+		pretty, err := afero.ReadFile(clients.FS, "/pretty.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(pretty)).To(ContainSubstring("outage since"))
+		Expect(string(pretty)).To(MatchRegexp(`outage over, down from .* failed probes\): status 502`))
+	})
+
+	It("keeps the outages of a CSV recording when annotating it", func() {
+		opts.OutputFile = "/output.csv"
+		opts.Format = clients.FormatCSV
+		opts.Sinks = nil
+		prober := clients.NewProber(&opts, new(clientsfakes.FakeBosh))
+		Expect(prober.RecordDowntime()).To(Succeed())
+		opts.BoshTask = "111"
+		_, err := prober.AnnotateDeployment()
+		Expect(err).NotTo(HaveOccurred())
+
+		csv, err := afero.ReadFile(clients.FS, "/output.csv")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(csv)).To(ContainSubstring("outage start: status 502"))
+		Expect(string(csv)).To(ContainSubstring("outage done"))
+	})
+
+	It("summarizes the recording with its outages", func() {
+		Expect(clients.NewProber(&opts, new(clientsfakes.FakeBosh)).RecordDowntime()).To(Succeed())
+		summary, err := clients.NewProber(&opts, new(clientsfakes.FakeBosh)).Summarize()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(summary.Outages).To(HaveLen(1))
+		Expect(summary.String()).To(ContainSubstring("outages: 1, 0 flapping, longest"))
+	})
+})
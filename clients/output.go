@@ -0,0 +1,168 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// Gap is a time downtimer wasn't recording, between an interrupted recording
+// and the one appended to it.
+type Gap struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// resultWriter writes each probe result to the output file together with
+// the annotations that came up since the previous one.
+type resultWriter interface {
+	Write(result Result, annotations []Annotation) error
+}
+
+// outageWriter is a resultWriter of a format with outage records.
+type outageWriter interface {
+	WriteOutage(outage Outage) error
+}
+
+type csvResultWriter struct {
+	writer  *csv.Writer
+	version int
+}
+
+func (w csvResultWriter) Write(result Result, annotations []Annotation) error {
+	w.writer.Write(append(getCvsRow(result, w.version), joinAnnotations(annotations)))
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// newResultWriter writes CSV in the layout version.
+func newResultWriter(format, target string, version int, output io.Writer) resultWriter {
+	if format == FormatJSONL {
+		return jsonlResultWriter{encoder: json.NewEncoder(output), target: target}
+	}
+	return csvResultWriter{writer: csv.NewWriter(output), version: version}
+}
+
+func writeCsvHeader(output io.Writer) error {
+	csvWriter := csv.NewWriter(output)
+	csvWriter.Write(csvHeader)
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// openOutput creates the output file, or with --append opens an existing one
+// for appending after checking that it is a recording in the same format. It
+// returns the first and last timestamp of the existing results, which are
+// zero if there are none, and keeps the CSV layout version to write in.
+func (p *Prober) openOutput() (afero.File, time.Time, time.Time, error) {
+	first, last := time.Time{}, time.Time{}
+	p.outputVersion = csvSchema
+	if p.opts.Append {
+		info, err := FS.Stat(p.opts.OutputFile)
+		if err == nil && info.Size() > 0 {
+			if !info.Mode().IsRegular() {
+				return nil, first, last, fmt.Errorf("cannot append to %s: not a regular file", p.opts.OutputFile)
+			}
+			if first, last, p.outputVersion, err = readTimespan(p.opts.OutputFile, p.opts.Format); err != nil {
+				return nil, first, last, fmt.Errorf("cannot append to %s: %s", p.opts.OutputFile, err)
+			}
+			file, err := FS.OpenFile(p.opts.OutputFile, os.O_WRONLY|os.O_APPEND, 0644)
+			return file, first, last, err
+		}
+	}
+	file, err := FS.Create(p.opts.OutputFile)
+	if err != nil || p.opts.Format == FormatJSONL {
+		return file, first, last, err
+	}
+	return file, first, last, writeCsvHeader(file)
+}
+
+// readTimespan checks that a file is a recording in the format and returns
+// its first and last timestamp and, for CSV, its layout version.
+func readTimespan(filename, format string) (time.Time, time.Time, int, error) {
+	first, last := time.Time{}, time.Time{}
+	inputFile, err := FS.Open(filename)
+	if err != nil {
+		return first, last, 0, err
+	}
+	defer inputFile.Close()
+
+	var results []Result
+	version := csvSchema
+	input := bufio.NewReader(inputFile)
+	if format == FormatJSONL {
+		if !isJSONL(input) {
+			return first, last, 0, errors.New("not a JSON Lines recording")
+		}
+		results, err = readJSONLResults(input)
+	} else {
+		results, version, err = readAppendableCsv(input)
+	}
+	if err != nil || len(results) == 0 {
+		return first, last, version, err
+	}
+	return results[0].Timestamp, results[len(results)-1].Timestamp, version, nil
+}
+
+// readAppendableCsv reads a CSV recording in a layout that can be appended
+// to, version 2 or later.
+func readAppendableCsv(input io.Reader) ([]Result, int, error) {
+	csvReader := csv.NewReader(input)
+	header, err := csvReader.Read()
+	if err != nil {
+		return nil, 0, err
+	}
+	version, err := csvVersion(header)
+	if err != nil {
+		return nil, 0, err
+	}
+	if version < 2 {
+		return nil, 0, fmt.Errorf("recorded in CSV layout version %d, can only append to version 2 or later", version)
+	}
+	results, err := readCsvResults(csvReader, version)
+	return results, version, err
+}
+
+func (d DeploymentTimes) AddGaps(gaps []Gap) {
+	for _, gap := range gaps {
+		d.add(unixMillis(gap.Start), gapAnnotation("start"))
+		d.add(unixMillis(gap.End), gapAnnotation("done"))
+	}
+}
+
+func gapAnnotation(phase string) Annotation {
+	return Annotation{ObjectType: "window", ObjectName: "not recording", Phase: phase}
+}
+
+func (p *Prober) addGap(gap Gap) {
+	p.windowsLock.Lock()
+	defer p.windowsLock.Unlock()
+	p.windows.Gaps = append(p.windows.Gaps, gap)
+}
@@ -0,0 +1,340 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// InstanceUpdate is the time BOSH spent on an instance, from its start to
+// its done event.
+type InstanceUpdate struct {
+	Start time.Time
+	End   time.Time
+	Error string
+}
+
+// InstanceLane is the updates of one instance during a recording.
+type InstanceLane struct {
+	Instance string
+	Updates  []InstanceUpdate
+}
+
+// Group is the instance group of the instance, e.g. router for
+// router/0a1b2c.
+func (l InstanceLane) Group() string {
+	if slash := strings.LastIndex(l.Instance, "/"); slash != -1 {
+		return l.Instance[:slash]
+	}
+	return l.Instance
+}
+
+// Report is what the HTML report shows of a recording.
+type Report struct {
+	Recording string
+	Target    string
+	Interval  time.Duration
+	Generated time.Time
+	Start     time.Time
+	End       time.Time
+	// DeployStart and DeployEnd are the deployment window, or the whole
+	// recording if it had no deployment.
+	DeployStart time.Time
+	DeployEnd   time.Time
+	Summary     Summary
+	Lanes       []InstanceLane
+	Gaps        []Gap
+	rows        []jsonlResult
+}
+
+// NewReport reads a recording, its annotations and, if it was annotated
+// with a deployment, its metadata. The options supply the target and the
+// probe interval of recordings without metadata.
+func NewReport(recording string, opts *Opts) (Report, error) {
+	rows, outages, err := readAnnotatedResults(recording)
+	if err != nil {
+		return Report{}, err
+	}
+	if len(rows) == 0 {
+		return Report{}, fmt.Errorf("%s has no probe results", recording)
+	}
+
+	report := Report{
+		Recording: recording,
+		Target:    opts.URL,
+		Interval:  opts.Interval,
+		Generated: time.Now(),
+		Start:     rows[0].Timestamp,
+		End:       rows[len(rows)-1].Timestamp,
+		rows:      rows,
+	}
+	if report.Target == "" {
+		report.Target = rows[0].Target
+	}
+	metadata, err := ReadMetadata(recording)
+	if err != nil && !os.IsNotExist(err) {
+		return Report{}, err
+	}
+	if metadata.URL != "" {
+		report.Target = metadata.URL
+	}
+	if metadata.Interval != 0 {
+		report.Interval = metadata.Interval
+	}
+	report.Gaps = metadata.Windows.Gaps
+
+	results := []Result{}
+	for i := range rows {
+		rows[i].Target = report.Target
+		results = append(results, rows[i].result())
+	}
+	stages := report.readAnnotations()
+	if !metadata.Windows.DeployStart.IsZero() {
+		report.DeployStart, report.DeployEnd = metadata.Windows.DeployStart, metadata.Windows.DeployEnd
+	}
+	if report.DeployStart.IsZero() {
+		report.DeployStart = report.Start
+	}
+	if report.DeployEnd.IsZero() {
+		report.DeployEnd = report.End
+	}
+	report.Summary = Summarize(results, stages, report.Interval)
+	report.Summary.Tasks = metadata.Tasks
+	if len(outages) == 0 {
+		outages = FindOutages(results, opts.OutagePolicy())
+	}
+	report.Summary.SetOutages(outages)
+	if !metadata.Windows.DeployStart.IsZero() {
+		report.Summary.Phases = SummarizePhases(results, metadata.Windows, outages)
+	}
+	for _, gap := range report.Gaps {
+		report.Summary.NotRecording += gap.End.Sub(gap.Start)
+	}
+	return report, nil
+}
+
+// readAnnotations pairs the start and end annotations of the task stages
+// and of the instance updates, which make the lanes of the report. Anything
+// unfinished lasts until the end of the recording.
+func (r *Report) readAnnotations() []Stage {
+	stages := []Stage{}
+	openStages := map[string]int{}
+	lanes := map[string]int{}
+	for _, row := range r.rows {
+		for _, annotation := range row.Annotations {
+			name := annotation.ObjectName
+			if label := deploymentLabel(annotation.Director, annotation.Deployment); label != "" {
+				name = label + ": " + name
+			}
+			switch annotation.ObjectType {
+			case "window":
+				if annotation.ObjectName == PhaseDeploy && annotation.Phase == "start" {
+					r.DeployStart = row.Timestamp
+				}
+				if annotation.ObjectName == PhaseDeploy && annotation.Phase == "done" {
+					r.DeployEnd = row.Timestamp
+				}
+			case "stage":
+				if annotation.Phase == "start" {
+					stages = append(stages, Stage{Director: annotation.Director, Deployment: annotation.Deployment, Name: annotation.ObjectName, Start: row.Timestamp})
+					openStages[name] = len(stages) - 1
+				} else if i, ok := openStages[name]; ok {
+					stages[i].End = row.Timestamp
+					stages[i].Failed = annotation.Phase == "failed"
+					delete(openStages, name)
+				}
+			case "instance":
+				i, ok := lanes[name]
+				if !ok {
+					r.Lanes = append(r.Lanes, InstanceLane{Instance: name})
+					i = len(r.Lanes) - 1
+					lanes[name] = i
+				}
+				updates := r.Lanes[i].Updates
+				if annotation.Phase == "start" {
+					r.Lanes[i].Updates = append(updates, InstanceUpdate{Start: row.Timestamp})
+				} else if len(updates) > 0 && updates[len(updates)-1].End.IsZero() {
+					updates[len(updates)-1].End = row.Timestamp
+					updates[len(updates)-1].Error = annotation.Error
+				}
+			}
+		}
+	}
+	for _, lane := range r.Lanes {
+		for i := range lane.Updates {
+			if lane.Updates[i].End.IsZero() {
+				lane.Updates[i].End = r.End
+			}
+		}
+	}
+	return stages
+}
+
+// readAnnotatedResults reads a recording in either output format along with
+// the annotations of every result, and the outage records of a JSON Lines
+// recording.
+func readAnnotatedResults(filename string) ([]jsonlResult, []Outage, error) {
+	inputFile, err := FS.Open(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer inputFile.Close()
+
+	input := bufio.NewReader(inputFile)
+	rows := []jsonlResult{}
+	if isJSONL(input) {
+		outages := []Outage{}
+		err := readJSONL(input, func(line jsonlLine) error {
+			if line.outage != nil {
+				outages = append(outages, line.outage.Outage)
+			} else {
+				rows = append(rows, *line.result)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return rows, outages, nil
+	}
+
+	csvReader := csv.NewReader(input)
+	csvReader.FieldsPerRecord = -1
+	header, err := csvReader.Read()
+	if err != nil {
+		return nil, nil, err
+	}
+	version, err := csvVersion(header)
+	if err != nil {
+		return nil, nil, err
+	}
+	annotationColumn := len(header) - 1
+	for line := 2; ; line++ {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			return rows, nil, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		result, err := parseCsvRow(record, version)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %s", line, err)
+		}
+		annotations := []Annotation{}
+		if len(record) > annotationColumn && record[annotationColumn] != "" {
+			for _, text := range strings.Split(record[annotationColumn], "\n") {
+				annotations = append(annotations, parseAnnotation(text))
+			}
+		}
+		rows = append(rows, newJSONLResult(result, "", annotations))
+	}
+}
+
+// ReadOutages returns the outages recorded in a JSON Lines recording, or
+// finds them with the policy in a CSV one or one without outage records.
+func ReadOutages(filename string, policy OutagePolicy) ([]Outage, error) {
+	rows, outages, err := readAnnotatedResults(filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(outages) > 0 {
+		return outages, nil
+	}
+	results := []Result{}
+	for _, row := range rows {
+		results = append(results, row.result())
+	}
+	return FindOutages(results, policy), nil
+}
+
+// WriteHTML writes the report as a single HTML file that works offline: the
+// recording is embedded as JSON Lines data, the chart is inline SVG.
+func (r Report) WriteHTML(output io.Writer) error {
+	data := bytes.Buffer{}
+	encoder := json.NewEncoder(&data)
+	for _, row := range r.rows {
+		if err := encoder.Encode(row); err != nil {
+			return err
+		}
+	}
+	escaped := bytes.Buffer{}
+	json.HTMLEscape(&escaped, data.Bytes())
+
+	return reportTemplate.Execute(output, struct {
+		Report
+		Chart reportChart
+		Data  template.JS
+	}{r, newReportChart(r), template.JS(escaped.String())})
+}
+
+// WriteHTMLReport turns a recording into an HTML report.
+func WriteHTMLReport(recording, filename string, opts *Opts) error {
+	report, err := NewReport(recording, opts)
+	if err != nil {
+		return err
+	}
+	output, err := FS.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer output.Close()
+	return report.WriteHTML(output)
+}
+
+// InstanceGroupDowntime attributes the probes during outages to the
+// instance groups that were being updated at the time.
+func (r Report) InstanceGroupDowntime() map[string]time.Duration {
+	downtime := map[string]time.Duration{}
+	for _, lane := range r.Lanes {
+		downtime[lane.Group()] = 0
+	}
+	for _, row := range r.rows {
+		if !r.down(row.Timestamp) {
+			continue
+		}
+		updating := map[string]bool{}
+		for _, lane := range r.Lanes {
+			for _, update := range lane.Updates {
+				if !row.Timestamp.Before(update.Start) && !row.Timestamp.After(update.End) {
+					updating[lane.Group()] = true
+				}
+			}
+		}
+		for group := range updating {
+			downtime[group] += r.Interval
+		}
+	}
+	return downtime
+}
+
+func (r Report) down(t time.Time) bool {
+	for _, outage := range r.Summary.Outages {
+		if outage.contains(t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pivotal-cf/downtimer/clients"
+	"github.com/spf13/afero"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// writeRecording writes a CSV recording with a probe every second, failing
+// where failed says so.
+func writeRecording(filename string, start time.Time, probes int, failed func(int) bool, annotations map[int]string) {
+	recording := bytes.Buffer{}
+	writer := csv.NewWriter(&recording)
+	writer.Write([]string{"version", "timestamp_ms", "success", "latency_ms", "code", "size", "error", "annotation"})
+	for i := 0; i < probes; i++ {
+		timestamp := fmt.Sprint(start.Add(time.Duration(i)*time.Second).UnixNano() / int64(time.Millisecond))
+		if failed(i) {
+			writer.Write([]string{"2", timestamp, "0", "0.000", "502", "0", "", annotations[i]})
+		} else {
+			writer.Write([]string{"2", timestamp, "1", "3.500", "200", "79", "", annotations[i]})
+		}
+	}
+	writer.Flush()
+	Expect(afero.WriteFile(clients.FS, filename, recording.Bytes(), 0644)).To(Succeed())
+}
+
+var _ = Describe("HTML report", func() {
+	start := time.Date(2017, 8, 1, 10, 0, 0, 0, time.UTC)
+	annotations := map[int]string{
+		5:  "stage Updating instance router start\nupdate instance router/abc start",
+		15: "update instance router/abc done\nstage Updating instance router done",
+		18: "prod/cf: update instance api/def start",
+		25: "prod/cf: update instance api/def done: Timed out <pinging> agent",
+	}
+	var opts clients.Opts
+
+	BeforeEach(func() {
+		clients.FS = afero.NewMemMapFs()
+		writeRecording("/recording.csv", start, 30, func(i int) bool { return i >= 10 && i < 14 }, annotations)
+		opts = clients.Opts{Interval: time.Second, OutageFailures: 3, OutageSuccesses: 3}
+	})
+
+	It("summarizes the recording with its outages and instance updates", func() {
+		Expect(clients.WriteMetadata("/recording.csv", clients.Metadata{
+			URL:      "https://app.example.com",
+			Interval: time.Second,
+			Tasks:    []clients.TaskResult{{TaskID: "42", State: "done"}},
+		})).To(Succeed())
+		report, err := clients.NewReport("/recording.csv", &opts)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(report.Target).To(Equal("https://app.example.com"))
+		Expect(report.Summary.Failures).To(Equal(4))
+		Expect(report.Summary.Downtime).To(Equal(4 * time.Second))
+		Expect(report.Summary.Outages).To(HaveLen(1))
+		Expect(report.Summary.Outages[0].Start).To(BeTemporally("==", start.Add(10*time.Second)))
+		Expect(report.Summary.Stages).To(HaveLen(1))
+		Expect(report.Summary.Stages[0].Failures).To(Equal(4))
+
+		Expect(report.Lanes).To(HaveLen(2))
+		Expect(report.Lanes[0].Instance).To(Equal("router/abc"))
+		Expect(report.Lanes[0].Updates).To(HaveLen(1))
+		Expect(report.Lanes[0].Updates[0].Start).To(BeTemporally("==", start.Add(5*time.Second)))
+		Expect(report.Lanes[0].Updates[0].End).To(BeTemporally("==", start.Add(15*time.Second)))
+		Expect(report.Lanes[1].Instance).To(Equal("prod/cf: api/def"))
+		Expect(report.Lanes[1].Updates[0].Error).To(Equal("Timed out <pinging> agent"))
+	})
+
+	It("writes a single HTML file with the chart, the summary and the data", func() {
+		opts.URL = "https://app.example.com"
+		Expect(clients.WriteHTMLReport("/recording.csv", "/report.html", &opts)).To(Succeed())
+		contents, err := afero.ReadFile(clients.FS, "/report.html")
+		Expect(err).NotTo(HaveOccurred())
+		html := string(contents)
+
+		Expect(html).To(ContainSubstring("<title>Downtime of https://app.example.com</title>"))
+		Expect(html).NotTo(MatchRegexp(`<script[^>]* src=|<link`))
+		Expect(html).To(ContainSubstring(`<rect class="outage"`))
+		Expect(strings.Count(html, `<rect class="failure"`)).To(Equal(4))
+		Expect(html).To(ContainSubstring(`<text x="0" y="296" dy="12">prod/cf: api/def</text>`))
+		Expect(html).To(ContainSubstring(`<rect class="update failed"`))
+		Expect(html).To(ContainSubstring("Timed out &lt;pinging&gt; agent"))
+		Expect(html).To(ContainSubstring("<tr><th>Failed probes</th><td class=\"number\">4</td></tr>"))
+		Expect(html).To(ContainSubstring("<td>Updating instance router</td>"))
+		Expect(html).To(ContainSubstring(`"error":"Timed`))
+		Expect(html).NotTo(ContainSubstring(`<pinging>`))
+		Expect(strings.Count(html, `"target":"https://app.example.com"`)).To(Equal(30))
+	})
+
+	It("reads JSON Lines recordings", func() {
+		recording := `{"timestamp":"2017-08-01T10:00:00Z","target":"https://app.example.com","success":true,"latency_ms":3.5,"status_code":200,"size":79,"annotations":[{"action":"update","object_type":"instance","object_name":"router/abc","phase":"start"}]}
+{"timestamp":"2017-08-01T10:00:01Z","target":"https://app.example.com","success":false,"latency_ms":0,"status_code":0,"size":0,"error":"connection refused"}
+{"timestamp":"2017-08-01T10:00:02Z","target":"https://app.example.com","success":true,"latency_ms":3.5,"status_code":200,"size":79,"annotations":[{"action":"update","object_type":"instance","object_name":"router/abc","phase":"done"}]}
+`
+		Expect(afero.WriteFile(clients.FS, "/recording.jsonl", []byte(recording), 0644)).To(Succeed())
+		report, err := clients.NewReport("/recording.jsonl", &opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Target).To(Equal("https://app.example.com"))
+		Expect(report.Summary.Probes).To(Equal(3))
+		Expect(report.Summary.Failures).To(Equal(1))
+		Expect(report.Lanes).To(HaveLen(1))
+		Expect(report.Lanes[0].Updates[0].End).To(BeTemporally("==", start.Add(2*time.Second)))
+	})
+
+	It("fails on an empty recording", func() {
+		Expect(afero.WriteFile(clients.FS, "/empty.csv", []byte("version,timestamp_ms,success,latency_ms,code,size,error,annotation\n"), 0644)).To(Succeed())
+		_, err := clients.NewReport("/empty.csv", &opts)
+		Expect(err).To(MatchError("/empty.csv has no probe results"))
+	})
+})
@@ -0,0 +1,148 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	chartLeft       = 240
+	chartPlotWidth  = 760
+	chartPlotHeight = 240
+	chartLaneTop    = chartPlotHeight + 40
+	chartLaneHeight = 16
+	chartTicks      = 6
+)
+
+type svgRect struct {
+	X, Y, Width, Height float64
+	Title               string
+	Flapping            bool
+}
+
+type svgTick struct {
+	X     float64
+	Label string
+}
+
+type svgLane struct {
+	Label   string
+	Y       float64
+	Updates []svgRect
+	Failed  []svgRect
+}
+
+// reportChart lays out the SVG chart of a report: the latency of the
+// successful probes, failed probes as ticks at the top, outages as bands
+// and a lane per instance below, all on the same time axis.
+type reportChart struct {
+	Width      int
+	Height     int
+	Left       int
+	Right      int
+	PlotWidth  int
+	PlotHeight int
+	MaxLatency string
+	Latency    []string
+	Failures   []svgRect
+	Outages    []svgRect
+	Gaps       []svgRect
+	Ticks      []svgTick
+	Lanes      []svgLane
+}
+
+func newReportChart(r Report) reportChart {
+	chart := reportChart{
+		Width:      chartLeft + chartPlotWidth + 20,
+		Height:     chartLaneTop + chartLaneHeight*len(r.Lanes) + 10,
+		Left:       chartLeft,
+		Right:      chartLeft + chartPlotWidth,
+		PlotWidth:  chartPlotWidth,
+		PlotHeight: chartPlotHeight,
+	}
+	span := r.End.Sub(r.Start)
+	if span <= 0 {
+		span = time.Second
+	}
+	x := func(t time.Time) float64 {
+		return chartLeft + float64(chartPlotWidth)*float64(t.Sub(r.Start))/float64(span)
+	}
+	width := func(start, end time.Time) float64 {
+		if w := x(end) - x(start); w > 1 {
+			return w
+		}
+		return 1
+	}
+
+	maxLatency := time.Millisecond
+	for _, row := range r.rows {
+		if latency := time.Duration(row.LatencyMs * float64(time.Millisecond)); row.Success && latency > maxLatency {
+			maxLatency = latency
+		}
+	}
+	chart.MaxLatency = maxLatency.String()
+	points := []string{}
+	for _, row := range r.rows {
+		if !row.Success {
+			if len(points) > 0 {
+				chart.Latency = append(chart.Latency, strings.Join(points, " "))
+				points = nil
+			}
+			title := fmt.Sprintf("%s: status %d", row.Timestamp.Format("15:04:05.000"), row.StatusCode)
+			if row.Error != "" {
+				title = fmt.Sprintf("%s: %s", row.Timestamp.Format("15:04:05.000"), row.Error)
+			}
+			chart.Failures = append(chart.Failures, svgRect{X: x(row.Timestamp), Y: 0, Width: 1, Height: 8, Title: title})
+			continue
+		}
+		latency := time.Duration(row.LatencyMs * float64(time.Millisecond))
+		y := float64(chartPlotHeight) * (1 - float64(latency)/float64(maxLatency))
+		points = append(points, fmt.Sprintf("%.1f,%.1f", x(row.Timestamp), y))
+	}
+	if len(points) > 0 {
+		chart.Latency = append(chart.Latency, strings.Join(points, " "))
+	}
+
+	for _, outage := range r.Summary.Outages {
+		chart.Outages = append(chart.Outages, svgRect{X: x(outage.Start), Height: chartPlotHeight, Width: width(outage.Start, outage.End), Title: outage.String(), Flapping: outage.Flapping})
+	}
+	for _, gap := range r.Gaps {
+		chart.Gaps = append(chart.Gaps, svgRect{X: x(gap.Start), Height: chartPlotHeight, Width: width(gap.Start, gap.End), Title: "not recording"})
+	}
+	for i := 0; i < chartTicks; i++ {
+		t := r.Start.Add(span * time.Duration(i) / (chartTicks - 1))
+		chart.Ticks = append(chart.Ticks, svgTick{X: x(t), Label: t.Format("15:04:05")})
+	}
+
+	for i, lane := range r.Lanes {
+		svg := svgLane{Label: lane.Instance, Y: float64(chartLaneTop + chartLaneHeight*i)}
+		for _, update := range lane.Updates {
+			rect := svgRect{X: x(update.Start), Y: svg.Y + 2, Width: width(update.Start, update.End), Height: chartLaneHeight - 4,
+				Title: fmt.Sprintf("%s %s to %s", lane.Instance, update.Start.Format("15:04:05"), update.End.Format("15:04:05"))}
+			if update.Error != "" {
+				rect.Title += ": " + update.Error
+				svg.Failed = append(svg.Failed, rect)
+			} else {
+				svg.Updates = append(svg.Updates, rect)
+			}
+		}
+		chart.Lanes = append(chart.Lanes, svg)
+	}
+	return chart
+}
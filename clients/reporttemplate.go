@@ -0,0 +1,110 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients
+
+import "html/template"
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"taskFailed": TaskFailed,
+	"stageLabel": func(stage Stage) string {
+		if label := deploymentLabel(stage.Director, stage.Deployment); label != "" {
+			return label + ": " + stage.Label()
+		}
+		return stage.Label()
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Downtime of {{.Target}}</title>
+<style>
+body { font: 13px "Helvetica Neue", Helvetica, Arial, sans-serif; margin: 20px; }
+h1 { font-size: 20px; }
+h2 { font-size: 16px; margin-top: 24px; }
+table { border-collapse: collapse; }
+th, td { text-align: left; padding: 3px 12px 3px 0; border-bottom: 1px solid #ddd; }
+td.number { text-align: right; }
+tr.failed td { color: #c00; }
+svg text { font-size: 10px; fill: #555; }
+.axis { stroke: #000; }
+.latency { fill: none; stroke: steelblue; stroke-width: 1.5px; }
+.failure { fill: #c00; }
+.outage { fill: pink; }
+.outage.flapping { fill: #fde0b0; }
+.gap { fill: #eee; }
+.update { fill: steelblue; }
+.update.failed { fill: #c00; }
+.lane { stroke: #eee; }
+</style>
+</head>
+<body>
+<h1>Downtime of {{.Target}}</h1>
+<p>Recorded from {{.Start.Format "2006-01-02 15:04:05 MST"}} to {{.End.Format "2006-01-02 15:04:05 MST"}}, probing every {{.Interval}}. Report generated {{.Generated.Format "2006-01-02 15:04:05 MST"}}.</p>
+
+<svg width="{{.Chart.Width}}" height="{{.Chart.Height}}" xmlns="http://www.w3.org/2000/svg">
+{{range .Chart.Gaps}}<rect class="gap" x="{{.X}}" y="{{.Y}}" width="{{.Width}}" height="{{.Height}}"><title>{{.Title}}</title></rect>
+{{end}}{{range .Chart.Outages}}<rect class="outage{{if .Flapping}} flapping{{end}}" x="{{.X}}" y="{{.Y}}" width="{{.Width}}" height="{{.Height}}"><title>{{.Title}}</title></rect>
+{{end}}{{range .Chart.Latency}}<polyline class="latency" points="{{.}}"/>
+{{end}}{{range .Chart.Failures}}<rect class="failure" x="{{.X}}" y="{{.Y}}" width="{{.Width}}" height="{{.Height}}"><title>{{.Title}}</title></rect>
+{{end}}<line class="axis" x1="{{.Chart.Left}}" y1="0" x2="{{.Chart.Left}}" y2="{{.Chart.PlotHeight}}"/>
+<line class="axis" x1="{{.Chart.Left}}" y1="{{.Chart.PlotHeight}}" x2="{{.Chart.Right}}" y2="{{.Chart.PlotHeight}}"/>
+<text x="{{.Chart.Left}}" y="10" dx="-6" text-anchor="end">{{.Chart.MaxLatency}}</text>
+<text x="{{.Chart.Left}}" y="{{.Chart.PlotHeight}}" dx="-6" text-anchor="end">0</text>
+<text x="{{.Chart.Left}}" y="{{.Chart.PlotHeight}}" dx="-6" dy="-14" text-anchor="end">latency</text>
+{{range .Chart.Ticks}}<text x="{{.X}}" y="{{$.Chart.PlotHeight}}" dy="14" text-anchor="middle">{{.Label}}</text>
+{{end}}{{range .Chart.Lanes}}<line class="lane" x1="0" y1="{{.Y}}" x2="{{$.Chart.Width}}" y2="{{.Y}}"/>
+<text x="0" y="{{.Y}}" dy="12">{{.Label}}</text>
+{{range .Updates}}<rect class="update" x="{{.X}}" y="{{.Y}}" width="{{.Width}}" height="{{.Height}}"><title>{{.Title}}</title></rect>
+{{end}}{{range .Failed}}<rect class="update failed" x="{{.X}}" y="{{.Y}}" width="{{.Width}}" height="{{.Height}}"><title>{{.Title}}</title></rect>
+{{end}}{{end}}</svg>
+
+<h2>Summary</h2>
+<table>
+{{range .Summary.Tasks}}<tr{{if taskFailed .State}} class="failed"{{end}}><th>{{.}}</th><td>{{.State}}</td></tr>
+{{end}}<tr><th>Probes</th><td class="number">{{.Summary.Probes}}</td></tr>
+<tr><th>Failed probes</th><td class="number">{{.Summary.Failures}}</td></tr>
+{{range .Summary.ErrorClassCounts}}<tr><th>&nbsp;&nbsp;{{.Class}}</th><td class="number">{{.Failures}}</td></tr>
+{{end}}<tr><th>Downtime</th><td class="number">{{.Summary.Downtime}}</td></tr>
+<tr><th>Availability</th><td class="number">{{printf "%.3f%%" .Summary.Availability}}</td></tr>
+<tr><th>Latency p50</th><td class="number">{{.Summary.P50}}</td></tr>
+<tr><th>Latency p95</th><td class="number">{{.Summary.P95}}</td></tr>
+{{if .Summary.NotRecording}}<tr><th>Not recording</th><td class="number">{{.Summary.NotRecording}}</td></tr>
+{{end}}</table>
+{{if .Summary.Phases}}
+<h2>Phases</h2>
+<table>
+<tr><th>Phase</th><th>Probes</th><th>Availability</th><th>Latency p50</th><th>Latency p95</th></tr>
+{{range .Summary.Phases}}<tr><td>{{.Phase}}</td><td class="number">{{.Probes}}</td><td class="number">{{printf "%.3f%%" .Availability}}</td><td class="number">{{.P50}}</td><td class="number">{{.P95}}</td></tr>
+{{end}}</table>
+{{end}}{{if .Summary.Outages}}
+<h2>Outages</h2>
+<table>
+<tr><th>From</th><th>To</th><th>Duration</th><th>Failed probes</th><th></th><th>Error</th></tr>
+{{range .Summary.Outages}}<tr><td>{{.Start.Format "15:04:05"}}</td><td>{{.End.Format "15:04:05"}}</td><td class="number">{{.Duration}}</td><td class="number">{{.Failures}}</td><td>{{if .Flapping}}flapping{{end}}{{if .Ongoing}} ongoing{{end}}</td><td>{{.Error}}</td></tr>
+{{end}}</table>
+{{end}}{{if .Summary.Stages}}
+<h2>Stages</h2>
+<table>
+<tr><th>Stage</th><th>From</th><th>To</th><th>Failed probes</th><th>Downtime</th></tr>
+{{range .Summary.Stages}}<tr{{if .Downtime}} class="failed"{{end}}><td>{{stageLabel .Stage}}</td><td>{{.Stage.Start.Format "15:04:05"}}</td><td>{{if not .Stage.End.IsZero}}{{.Stage.End.Format "15:04:05"}}{{end}}</td><td class="number">{{.Failures}} of {{.Probes}}</td><td class="number">{{.Downtime}}</td></tr>
+{{end}}</table>
+{{end}}
+<script type="application/json" id="recording">
+{{.Data}}
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,360 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sink receives the results of a recording as they come in, and the
+// annotations of what BOSH is doing in between.
+type Sink interface {
+	Annotate(annotations []Annotation) error
+	Result(result Result) error
+	Close() error
+}
+
+// slowCloser is a sink that may take longer than sinkCloseTimeout to close,
+// e.g. because it delivers over the network.
+type slowCloser interface {
+	closeTimeout() time.Duration
+}
+
+// OutageSink is a sink that also receives the outages of a recording:
+// once when an outage starts, without an end, and again when it ended.
+type OutageSink interface {
+	Outage(outage Outage) error
+}
+
+const (
+	sinkBacklog      = 100000
+	sinkCloseTimeout = 5 * time.Second
+)
+
+// fileSink writes results with the annotations since the previous one to a
+// file in one of the output formats.
+type fileSink struct {
+	writer  resultWriter
+	file    io.Closer
+	pending []Annotation
+}
+
+func (s *fileSink) Annotate(annotations []Annotation) error {
+	s.pending = append(s.pending, annotations...)
+	return nil
+}
+
+func (s *fileSink) Result(result Result) error {
+	annotations := s.pending
+	s.pending = nil
+	return s.writer.Write(result, annotations)
+}
+
+// Outage writes ended outages as records of their own if the format has
+// them, and annotates the next result otherwise.
+func (s *fileSink) Outage(outage Outage) error {
+	if writer, ok := s.writer.(outageWriter); ok {
+		if outage.End.IsZero() {
+			return nil
+		}
+		return writer.WriteOutage(outage)
+	}
+	if outage.End.IsZero() {
+		s.pending = append(s.pending, Annotation{ObjectType: "outage", Phase: "start", Error: outage.Error})
+	} else if !outage.Ongoing {
+		s.pending = append(s.pending, Annotation{ObjectType: "outage", Phase: "done"})
+	}
+	return nil
+}
+
+func (s *fileSink) Close() error {
+	return s.file.Close()
+}
+
+// prettySink prints results and annotations for people watching.
+type prettySink struct {
+	output io.WriteCloser
+}
+
+func (s prettySink) Annotate(annotations []Annotation) error {
+	for _, annotation := range annotations {
+		if _, err := fmt.Fprintf(s.output, "%12s %s\n", "", annotation); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s prettySink) Result(result Result) error {
+	timestamp := result.Timestamp.Format("15:04:05.000")
+	var err error
+	if result.Success == 1 {
+		_, err = fmt.Fprintf(s.output, "%s up   %d %s\n", timestamp, result.StatusCode, result.ResponseTime)
+	} else if result.Error != nil {
+		_, err = fmt.Fprintf(s.output, "%s DOWN %s: %s\n", timestamp, result.ErrorClass, result.Error)
+	} else {
+		_, err = fmt.Fprintf(s.output, "%s DOWN %s: %d\n", timestamp, result.ErrorClass, result.StatusCode)
+	}
+	return err
+}
+
+func (s prettySink) Outage(outage Outage) error {
+	var err error
+	if outage.End.IsZero() {
+		_, err = fmt.Fprintf(s.output, "%12s outage since %s\n", "", outage.Start.Format("15:04:05.000"))
+	} else if !outage.Ongoing {
+		_, err = fmt.Fprintf(s.output, "%12s outage over, %s\n", "", outage)
+	}
+	return err
+}
+
+func (s prettySink) Close() error {
+	return s.output.Close()
+}
+
+// ParseSink splits a --sink into its format and destination. The pretty
+// format prints to stderr unless told otherwise.
+func ParseSink(spec string) (string, string, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	format, destination := parts[0], ""
+	if len(parts) == 2 {
+		destination = parts[1]
+	}
+	switch format {
+	case "pretty":
+		if destination == "" {
+			destination = "/dev/stderr"
+		}
+	case FormatCSV, FormatJSONL:
+		if destination == "" {
+			return "", "", fmt.Errorf("sink %s needs a file, e.g. %s:recording.%s", spec, format, format)
+		}
+	default:
+		return "", "", fmt.Errorf("unknown sink format in %s, expected csv, jsonl or pretty", spec)
+	}
+	return format, destination, nil
+}
+
+func openSink(spec, target string) (Sink, error) {
+	format, destination, err := ParseSink(spec)
+	if err != nil {
+		return nil, err
+	}
+	file, err := FS.Create(destination)
+	if err != nil {
+		return nil, err
+	}
+	if format == "pretty" {
+		return prettySink{output: file}, nil
+	}
+	if format == FormatCSV {
+		if err := writeCsvHeader(file); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return &fileSink{writer: newResultWriter(format, target, csvSchema, file), file: file}, nil
+}
+
+// openSinks opens the sinks of a recording. The output file is written as
+// the results come in, so that it is complete once the recording returns.
+// The ones given with --sink, the webhook and the ones added to the prober
+// are isolated.
+func (p *Prober) openSinks(output io.WriteCloser) (sinks, error) {
+	opened := sinks{direct(p.opts.OutputFile, &fileSink{writer: newResultWriter(p.opts.Format, p.url, p.outputVersion, output), file: output})}
+	for _, spec := range p.opts.Sinks {
+		sink, err := openSink(spec, p.url)
+		if err != nil {
+			opened.close()
+			return nil, err
+		}
+		opened = append(opened, isolate(spec, sink))
+	}
+	if p.opts.WebhookURL != "" {
+		webhook, err := newWebhookSink(p.opts, p.url)
+		if err != nil {
+			opened.close()
+			return nil, err
+		}
+		opened = append(opened, isolate("webhook", webhook))
+	}
+	for _, sink := range p.sinks {
+		opened = append(opened, isolate(sink.name, sink.sink))
+	}
+	return opened, nil
+}
+
+// isolatedSink hands results to its sink in the background, so that a slow
+// or failing sink never holds up probing or the other sinks. Results queue
+// up while the sink is busy, and are dropped for it once too many did.
+// A direct one hands them over right away instead.
+type isolatedSink struct {
+	name    string
+	sink    Sink
+	direct  bool
+	lock    sync.Mutex
+	queue   []func(Sink) error
+	closed  bool
+	failing bool
+	dropped int
+	wake    chan struct{}
+	done    chan struct{}
+}
+
+func isolate(name string, sink Sink) *isolatedSink {
+	isolated := &isolatedSink{
+		name: name,
+		sink: sink,
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	go isolated.run()
+	return isolated
+}
+
+func direct(name string, sink Sink) *isolatedSink {
+	return &isolatedSink{name: name, sink: sink, direct: true}
+}
+
+func (s *isolatedSink) run() {
+	defer close(s.done)
+	for {
+		s.lock.Lock()
+		events, closed := s.queue, s.closed
+		s.queue = nil
+		s.lock.Unlock()
+
+		for _, event := range events {
+			s.handle(event)
+		}
+		if closed {
+			break
+		}
+		if len(events) == 0 {
+			<-s.wake
+		}
+	}
+	s.closeSink()
+}
+
+func (s *isolatedSink) handle(event func(Sink) error) {
+	err := event(s.sink)
+	if err != nil && !s.failing {
+		log.Println(fmt.Sprintf("Sink %s failed: %s", s.name, err))
+	}
+	if err == nil && s.failing {
+		log.Println(fmt.Sprintf("Sink %s recovered", s.name))
+	}
+	s.failing = err != nil
+}
+
+func (s *isolatedSink) closeSink() {
+	if err := s.sink.Close(); err != nil {
+		log.Println(fmt.Sprintf("Closing sink %s failed: %s", s.name, err))
+	}
+}
+
+func (s *isolatedSink) send(event func(Sink) error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return
+	}
+	if s.direct {
+		s.handle(event)
+		return
+	}
+	if len(s.queue) >= sinkBacklog {
+		if s.dropped++; s.dropped%sinkBacklog == 1 {
+			log.Println(fmt.Sprintf("Sink %s is falling behind, dropped %d updates so far", s.name, s.dropped))
+		}
+		return
+	}
+	s.queue = append(s.queue, event)
+	s.signal()
+}
+
+func (s *isolatedSink) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// close waits for an isolated sink to catch up, but not for long.
+func (s *isolatedSink) close() {
+	s.lock.Lock()
+	if s.direct {
+		defer s.lock.Unlock()
+		if !s.closed {
+			s.closed = true
+			s.closeSink()
+		}
+		return
+	}
+	s.closed = true
+	s.signal()
+	s.lock.Unlock()
+	timeout := sinkCloseTimeout
+	if slow, ok := s.sink.(slowCloser); ok {
+		timeout = slow.closeTimeout()
+	}
+	select {
+	case <-s.done:
+	case <-time.After(timeout):
+		log.Println(fmt.Sprintf("Sink %s did not finish in time", s.name))
+	}
+}
+
+type sinks []*isolatedSink
+
+func (s sinks) Annotate(annotations []Annotation) {
+	for _, sink := range s {
+		sink.send(func(sink Sink) error {
+			return sink.Annotate(annotations)
+		})
+	}
+}
+
+func (s sinks) Result(result Result) {
+	for _, sink := range s {
+		sink.send(func(sink Sink) error {
+			return sink.Result(result)
+		})
+	}
+}
+
+func (s sinks) Outage(outage Outage) {
+	for _, sink := range s {
+		if _, ok := sink.sink.(OutageSink); !ok {
+			continue
+		}
+		sink.send(func(sink Sink) error {
+			return sink.(OutageSink).Outage(outage)
+		})
+	}
+}
+
+func (s sinks) close() {
+	for _, sink := range s {
+		sink.close()
+	}
+}
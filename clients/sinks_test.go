@@ -0,0 +1,114 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients_test
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/pivotal-cf/downtimer/clients"
+	"github.com/pivotal-cf/downtimer/clients/clientsfakes"
+	"github.com/spf13/afero"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// stuckSink fails and blocks on every result until it is released.
+type stuckSink struct {
+	release chan struct{}
+	lock    sync.Mutex
+	results int
+}
+
+func (s *stuckSink) Annotate([]clients.Annotation) error {
+	return nil
+}
+
+func (s *stuckSink) Result(clients.Result) error {
+	<-s.release
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.results++
+	return errors.New("stuck")
+}
+
+func (s *stuckSink) Close() error {
+	return nil
+}
+
+var _ = Describe("Sinks", func() {
+	var opts clients.Opts
+	var prober *clients.Prober
+
+	BeforeEach(func() {
+		clients.FS = afero.NewMemMapFs()
+		opts = clients.Opts{
+			URL:        mockServer.URL + "/health",
+			OutputFile: "/output.csv",
+			Duration:   50 * time.Millisecond,
+			Interval:   10 * time.Millisecond,
+		}
+		prober = clients.NewProber(&opts, new(clientsfakes.FakeBosh))
+	})
+
+	It("writes the results to several sinks at once", func() {
+		opts.Sinks = []string{"jsonl:/extra.jsonl", "pretty:/pretty.txt"}
+		Expect(prober.RecordDowntime()).To(Succeed())
+
+		results, err := clients.ReadResults(opts.OutputFile)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(results).NotTo(BeEmpty())
+		extra, err := clients.ReadResults("/extra.jsonl")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(extra).To(HaveLen(len(results)))
+		pretty, err := afero.ReadFile(clients.FS, "/pretty.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(pretty)).To(MatchRegexp(`\d\d:\d\d:\d\d\.\d{3} up   200 `))
+	})
+
+	It("keeps probing while a sink is stuck", func() {
+		stuck := &stuckSink{release: make(chan struct{})}
+		prober.AddSink("stuck", stuck)
+		go func() {
+			time.Sleep(200 * time.Millisecond)
+			close(stuck.release)
+		}()
+
+		start := time.Now()
+		Expect(prober.RecordDowntime()).To(Succeed())
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		results, err := clients.ReadResults(opts.OutputFile)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(results)).To(BeNumerically(">=", 3))
+
+		stuck.lock.Lock()
+		defer stuck.lock.Unlock()
+		Expect(stuck.results).To(Equal(len(results)))
+	})
+
+	It("rejects unknown sinks", func() {
+		_, _, err := clients.ParseSink("xml:/out.xml")
+		Expect(err).To(MatchError("unknown sink format in xml:/out.xml, expected csv, jsonl or pretty"))
+		_, _, err = clients.ParseSink("csv")
+		Expect(err).To(MatchError(ContainSubstring("sink csv needs a file")))
+		format, destination, err := clients.ParseSink("pretty")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(format).To(Equal("pretty"))
+		Expect(destination).To(Equal("/dev/stderr"))
+	})
+})
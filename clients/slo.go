@@ -0,0 +1,74 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients
+
+import "fmt"
+
+// SLOResult is the outcome of checking a recording against one of the
+// service level objectives of the options.
+type SLOResult struct {
+	Name      string
+	Objective string
+	Actual    string
+	Met       bool
+}
+
+// CheckSLOs returns a result for every objective that is set.
+func CheckSLOs(summary Summary, opts *Opts) []SLOResult {
+	results := []SLOResult{}
+	if opts.SLOMaxDowntime != 0 {
+		results = append(results, SLOResult{
+			Name:      "max downtime",
+			Objective: opts.SLOMaxDowntime.String(),
+			Actual:    summary.Downtime.String(),
+			Met:       summary.Downtime <= opts.SLOMaxDowntime,
+		})
+	}
+	if opts.SLOMinAvailability != 0 {
+		results = append(results, SLOResult{
+			Name:      "min availability",
+			Objective: fmt.Sprintf("%.3f%%", opts.SLOMinAvailability),
+			Actual:    fmt.Sprintf("%.3f%%", summary.Availability()),
+			Met:       summary.Availability() >= opts.SLOMinAvailability,
+		})
+	}
+	if opts.SLOMaxP95Latency != 0 {
+		results = append(results, SLOResult{
+			Name:      "max p95 latency",
+			Objective: opts.SLOMaxP95Latency.String(),
+			Actual:    summary.P95.String(),
+			Met:       summary.P95 <= opts.SLOMaxP95Latency,
+		})
+	}
+	return results
+}
+
+func SLOsMet(results []SLOResult) bool {
+	for _, result := range results {
+		if !result.Met {
+			return false
+		}
+	}
+	return true
+}
+
+func (r SLOResult) String() string {
+	verdict := "met"
+	if !r.Met {
+		verdict = "breached"
+	}
+	return fmt.Sprintf("SLO %s %s: %s, %s", r.Name, r.Objective, r.Actual, verdict)
+}
@@ -0,0 +1,125 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Stage is a window of a BOSH task, e.g. compiling packages or updating
+// the canaries of an instance group, as reported in the task's event output.
+type Stage struct {
+	Director   string
+	Deployment string
+	Name       string
+	Tags       []string
+	Canary     bool
+	Start      time.Time
+	End        time.Time
+	Failed     bool
+}
+
+type taskEvent struct {
+	Time  int64    `json:"time"`
+	Stage string   `json:"stage"`
+	Tags  []string `json:"tags"`
+	Task  string   `json:"task"`
+	State string   `json:"state"`
+}
+
+func (s Stage) Label() string {
+	label := s.Name
+	if len(s.Tags) > 0 {
+		label += " " + strings.Join(s.Tags, ",")
+	}
+	if s.Canary {
+		label += " (canary)"
+	}
+	return label
+}
+
+// Contains reports whether t falls within the stage. A stage that never
+// finished is open ended.
+func (s Stage) Contains(t time.Time) bool {
+	if t.Before(s.Start) {
+		return false
+	}
+	return s.End.IsZero() || !t.After(s.End)
+}
+
+// ParseTaskEvents turns the JSON lines of a task's event output into stages.
+// Instance updates are split into a canary and a non-canary stage per
+// instance group.
+func ParseTaskEvents(output []byte) ([]Stage, error) {
+	stages := []Stage{}
+	index := map[string]int{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var event taskEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			return nil, err
+		}
+		if event.Stage == "" {
+			continue
+		}
+
+		canary := strings.HasSuffix(event.Task, "(canary)")
+		key := event.Stage + "|" + strings.Join(event.Tags, ",")
+		if canary {
+			key += "|canary"
+		}
+		eventTime := time.Unix(event.Time, 0)
+
+		i, ok := index[key]
+		if !ok {
+			stages = append(stages, Stage{Name: event.Stage, Tags: event.Tags, Canary: canary, Start: eventTime})
+			i = len(stages) - 1
+			index[key] = i
+		}
+		switch event.State {
+		case "finished":
+			stages[i].End = eventTime
+		case "failed":
+			stages[i].End = eventTime
+			stages[i].Failed = true
+		}
+	}
+	return stages, scanner.Err()
+}
+
+func (d DeploymentTimes) AddStages(stages []Stage) {
+	for _, stage := range stages {
+		annotation := Annotation{Director: stage.Director, Deployment: stage.Deployment, ObjectType: "stage", ObjectName: stage.Label(), Phase: "start"}
+		d.add(unixMillis(stage.Start), annotation)
+		if stage.End.IsZero() {
+			continue
+		}
+		annotation.Phase = "done"
+		if stage.Failed {
+			annotation.Phase = "failed"
+		}
+		d.add(unixMillis(stage.End), annotation)
+	}
+}
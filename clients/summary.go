@@ -0,0 +1,319 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+type StageSummary struct {
+	Stage    Stage
+	Probes   int
+	Failures int
+	Downtime time.Duration
+}
+
+type PhaseSummary struct {
+	Phase    string
+	Probes   int
+	Failures int
+	Recorded time.Duration
+	Downtime time.Duration
+	P50      time.Duration
+	P95      time.Duration
+}
+
+type Summary struct {
+	Tasks           []TaskResult
+	Probes          int
+	Failures        int
+	FailuresByClass map[string]int
+	Recorded        time.Duration
+	Downtime        time.Duration
+	P50             time.Duration
+	P95             time.Duration
+	NotRecording    time.Duration
+	Outages         []Outage
+	Stages          []StageSummary
+	Phases          []PhaseSummary
+}
+
+// Summarize attributes failed probes to the stages they happened in. The
+// recorded time lasts from the first probe to the last. Until the outages
+// are set, each failed probe accounts for one probe interval of downtime.
+// Latency is that of the successful probes.
+func Summarize(results []Result, stages []Stage, interval time.Duration) Summary {
+	summary := Summary{FailuresByClass: map[string]int{}}
+	for _, stage := range stages {
+		summary.Stages = append(summary.Stages, StageSummary{Stage: stage})
+	}
+
+	latencies := durations{}
+	for _, result := range results {
+		summary.Probes++
+		failed := result.Success == 0
+		if failed {
+			summary.Failures++
+			class := result.ErrorClass
+			if class == "" {
+				class = classifyResult(result)
+			}
+			summary.FailuresByClass[class]++
+			summary.Downtime += interval
+		} else {
+			latencies = append(latencies, result.ResponseTime)
+		}
+		for i := range summary.Stages {
+			if !summary.Stages[i].Stage.Contains(result.Timestamp) {
+				continue
+			}
+			summary.Stages[i].Probes++
+			if failed {
+				summary.Stages[i].Failures++
+				summary.Stages[i].Downtime += interval
+			}
+		}
+	}
+	if len(results) > 0 {
+		summary.Recorded = results[len(results)-1].Timestamp.Sub(results[0].Timestamp)
+	}
+	summary.P50 = latencies.percentile(50)
+	summary.P95 = latencies.percentile(95)
+	return summary
+}
+
+// SetOutages sets the outages of the recording. They make up its downtime
+// and that of the stages they overlap, so that single dropped probes don't
+// count.
+func (s *Summary) SetOutages(outages []Outage) {
+	s.Outages = outages
+	s.Downtime = 0
+	for _, outage := range outages {
+		s.Downtime += outage.Duration()
+	}
+	for i := range s.Stages {
+		s.Stages[i].Downtime = 0
+		for _, outage := range outages {
+			s.Stages[i].Downtime += outage.overlap(s.Stages[i].Stage.Start, s.Stages[i].Stage.End)
+		}
+	}
+}
+
+// SummarizePhases reports availability and the latency of successful probes
+// for the baseline, deployment and tail of a recording. The recorded time
+// and downtime of a phase are the parts of the recording and of the
+// outages within it.
+func SummarizePhases(results []Result, windows Windows, outages []Outage) []PhaseSummary {
+	phases := []PhaseSummary{}
+	if len(results) == 0 {
+		return phases
+	}
+	first, last := results[0].Timestamp, results[len(results)-1].Timestamp
+	for _, phase := range []string{PhaseBaseline, PhaseDeploy, PhaseTail} {
+		summary := PhaseSummary{Phase: phase}
+		start, end := windows.bounds(phase)
+		summary.Recorded = overlap(first, last, start, end)
+		for _, outage := range outages {
+			summary.Downtime += outage.overlap(start, end)
+		}
+		latencies := durations{}
+		for _, result := range results {
+			if windows.Phase(result.Timestamp) != phase {
+				continue
+			}
+			summary.Probes++
+			if result.Success == 0 {
+				summary.Failures++
+			} else {
+				latencies = append(latencies, result.ResponseTime)
+			}
+		}
+		if summary.Probes == 0 {
+			continue
+		}
+		summary.P50 = latencies.percentile(50)
+		summary.P95 = latencies.percentile(95)
+		phases = append(phases, summary)
+	}
+	return phases
+}
+
+// Availability is the share of the recorded time that wasn't downtime.
+func (s Summary) Availability() float64 {
+	return availability(s.Recorded, s.Downtime)
+}
+
+func (s PhaseSummary) Availability() float64 {
+	return availability(s.Recorded, s.Downtime)
+}
+
+func availability(recorded, downtime time.Duration) float64 {
+	if recorded <= 0 || downtime > recorded {
+		return 0
+	}
+	return 100 * float64(recorded-downtime) / float64(recorded)
+}
+
+type durations []time.Duration
+
+func (d durations) Len() int           { return len(d) }
+func (d durations) Less(i, j int) bool { return d[i] < d[j] }
+func (d durations) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+
+// percentile uses the nearest-rank method.
+func (d durations) percentile(p int) time.Duration {
+	if len(d) == 0 {
+		return 0
+	}
+	sorted := append(durations{}, d...)
+	sort.Sort(sorted)
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// TaskFailed reports whether any of the recorded tasks failed.
+func (s Summary) TaskFailed() bool {
+	for _, task := range s.Tasks {
+		if TaskFailed(task.State) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Summary) String() string {
+	lines := []string{}
+	for _, task := range s.Tasks {
+		if task.State != "" {
+			lines = append(lines, fmt.Sprintf("%s finished in state %s", task, task.State))
+		}
+	}
+	lines = append(lines, fmt.Sprintf("%d of %d probes failed, %s downtime", s.Failures, s.Probes, s.Downtime))
+	if s.Failures > 0 {
+		lines = append(lines, "failures by class: "+s.failureClasses())
+	}
+	if s.NotRecording != 0 {
+		lines = append(lines, fmt.Sprintf("not recording for %s", s.NotRecording))
+	}
+	if len(s.Outages) > 0 {
+		longest, flapping := time.Duration(0), 0
+		for _, outage := range s.Outages {
+			if outage.Duration() > longest {
+				longest = outage.Duration()
+			}
+			if outage.Flapping {
+				flapping++
+			}
+		}
+		lines = append(lines, fmt.Sprintf("outages: %d, %d flapping, longest %s", len(s.Outages), flapping, longest))
+		for _, outage := range s.Outages {
+			lines = append(lines, "  "+outage.String())
+		}
+	}
+	for _, phase := range s.Phases {
+		lines = append(lines, fmt.Sprintf("  %s: %.2f%% available, p50 %s, p95 %s over %d probes",
+			phase.Phase, phase.Availability(), phase.P50, phase.P95, phase.Probes))
+	}
+	for _, stage := range s.Stages {
+		label := stage.Stage.Label()
+		if deployment := deploymentLabel(stage.Stage.Director, stage.Stage.Deployment); deployment != "" {
+			label = deployment + ": " + label
+		}
+		lines = append(lines, fmt.Sprintf("  %s: %d of %d probes failed, %s downtime",
+			label, stage.Failures, stage.Probes, stage.Downtime))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ErrorClassCount is the number of failed probes of an error class.
+type ErrorClassCount struct {
+	Class    string
+	Failures int
+}
+
+// ErrorClassCounts lists the error classes failed probes had, in the order
+// of ErrorClasses.
+func (s Summary) ErrorClassCounts() []ErrorClassCount {
+	counts := []ErrorClassCount{}
+	for _, class := range ErrorClasses {
+		if s.FailuresByClass[class] > 0 {
+			counts = append(counts, ErrorClassCount{Class: class, Failures: s.FailuresByClass[class]})
+		}
+	}
+	return counts
+}
+
+func (s Summary) failureClasses() string {
+	classes := []string{}
+	for _, count := range s.ErrorClassCounts() {
+		classes = append(classes, fmt.Sprintf("%s %d", count.Class, count.Failures))
+	}
+	return strings.Join(classes, ", ")
+}
+
+// ReadResults loads the probe results back from a recording written by
+// RecordDowntime, in either output format.
+func ReadResults(filename string) ([]Result, error) {
+	inputFile, err := FS.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer inputFile.Close()
+
+	input := bufio.NewReader(inputFile)
+	if isJSONL(input) {
+		return readJSONLResults(input)
+	}
+	csvReader := csv.NewReader(input)
+	header, err := csvReader.Read()
+	if err != nil {
+		return nil, err
+	}
+	version, err := csvVersion(header)
+	if err != nil {
+		return nil, err
+	}
+	return readCsvResults(csvReader, version)
+}
+
+// readCsvResults reads the rows following the header.
+func readCsvResults(csvReader *csv.Reader, version int) ([]Result, error) {
+	csvReader.FieldsPerRecord = -1
+	results := []Result{}
+	for line := 2; ; line++ {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			return results, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		result, err := parseCsvRow(record, version)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+		results = append(results, result)
+	}
+}
@@ -0,0 +1,149 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// TaskWatcher polls the director's current tasks on behalf of everyone
+// following tasks on it, e.g. several probers of the daemon, at its own
+// rate. The delay between polls is jittered and backs off exponentially
+// while the director returns errors.
+type TaskWatcher struct {
+	bosh        Bosh
+	opts        *Opts
+	lock        sync.Mutex
+	subscribers map[chan []Task]bool
+	stop        chan struct{}
+}
+
+func NewTaskWatcher(bosh Bosh, opts *Opts) *TaskWatcher {
+	return &TaskWatcher{bosh: bosh, opts: opts, subscribers: map[chan []Task]bool{}}
+}
+
+// Subscribe returns a channel that receives the current tasks after every
+// poll, and a function to unsubscribe. The director is polled only while
+// there are subscribers, the first poll being one interval after the first
+// subscription. A subscriber that falls behind only gets the latest tasks.
+func (w *TaskWatcher) Subscribe() (<-chan []Task, func()) {
+	tasks := make(chan []Task, 1)
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.subscribers[tasks] = true
+	if len(w.subscribers) == 1 {
+		w.stop = make(chan struct{})
+		go w.poll(w.stop, *w.opts)
+	}
+	return tasks, func() {
+		w.unsubscribe(tasks)
+	}
+}
+
+func (w *TaskWatcher) unsubscribe(tasks chan []Task) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if !w.subscribers[tasks] {
+		return
+	}
+	delete(w.subscribers, tasks)
+	if len(w.subscribers) == 0 {
+		close(w.stop)
+	}
+}
+
+// WaitForDeploy returns the ID of the first deploy task that shows up, or
+// 0 if there was none before the timeout or stop was closed.
+func (w *TaskWatcher) WaitForDeploy(timeout time.Duration, stop <-chan struct{}) int {
+	updates, unsubscribe := w.Subscribe()
+	defer unsubscribe()
+
+	timeoutChannel := time.After(timeout)
+	for {
+		select {
+		case <-timeoutChannel:
+			log.Println("Bailed on getting the Task ID")
+			return 0
+		case <-stop:
+			return 0
+		case tasks := <-updates:
+			for _, task := range tasks {
+				if task.IsDeploy() {
+					return task.ID
+				}
+			}
+		}
+	}
+}
+
+// poll uses the settings of when polling started. Each delay counts from
+// when the previous poll finished, so a slow director isn't polled again
+// right away.
+func (w *TaskWatcher) poll(stop <-chan struct{}, opts Opts) {
+	delay := opts.BoshPollInterval
+	for {
+		timer := time.NewTimer(jittered(delay, opts.BoshPollJitter))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		tasks, err := w.bosh.GetCurrentTasks()
+		if err != nil {
+			delay = backoff(delay, opts)
+			log.Println(fmt.Sprintf("Polling the director for tasks failed, retrying in %s: %s", delay, err))
+			continue
+		}
+		delay = opts.BoshPollInterval
+		w.publish(tasks)
+	}
+}
+
+func (w *TaskWatcher) publish(tasks []Task) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for subscriber := range w.subscribers {
+		select {
+		case <-subscriber:
+		default:
+		}
+		subscriber <- tasks
+	}
+}
+
+func jittered(delay time.Duration, jitter float64) time.Duration {
+	if jitter <= 0 {
+		return delay
+	}
+	return delay + time.Duration((2*rand.Float64()-1)*jitter*float64(delay))
+}
+
+func backoff(delay time.Duration, opts Opts) time.Duration {
+	delay *= 2
+	if delay > opts.BoshPollMaxBackoff {
+		delay = opts.BoshPollMaxBackoff
+	}
+	if delay < opts.BoshPollInterval {
+		delay = opts.BoshPollInterval
+	}
+	return delay
+}
@@ -0,0 +1,114 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients_test
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/pivotal-cf/downtimer/clients"
+	"github.com/pivotal-cf/downtimer/clients/clientsfakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TaskWatcher", func() {
+	var bosh *clientsfakes.FakeBosh
+	var opts clients.Opts
+	var watcher *clients.TaskWatcher
+
+	BeforeEach(func() {
+		bosh = new(clientsfakes.FakeBosh)
+		bosh.GetCurrentTasksReturns([]clients.Task{{ID: 7, Deployment: "cf", Description: "create deployment"}}, nil)
+		opts = clients.Opts{
+			BoshPollInterval:   20 * time.Millisecond,
+			BoshPollMaxBackoff: 80 * time.Millisecond,
+		}
+		watcher = clients.NewTaskWatcher(bosh, &opts)
+	})
+
+	It("polls the director once for all subscribers", func() {
+		first, unsubscribeFirst := watcher.Subscribe()
+		second, unsubscribeSecond := watcher.Subscribe()
+		Eventually(first).Should(Receive(HaveLen(1)))
+		Eventually(second).Should(Receive(HaveLen(1)))
+		unsubscribeFirst()
+		unsubscribeSecond()
+
+		Expect(bosh.GetCurrentTasksCallCount()).To(BeNumerically("<=", 2))
+		calls := bosh.GetCurrentTasksCallCount()
+		Consistently(bosh.GetCurrentTasksCallCount, 100*time.Millisecond).Should(Equal(calls))
+	})
+
+	It("backs off while the director returns errors", func() {
+		var lock sync.Mutex
+		polls := []time.Time{}
+		bosh.GetCurrentTasksStub = func() ([]clients.Task, error) {
+			lock.Lock()
+			defer lock.Unlock()
+			polls = append(polls, time.Now())
+			return nil, errors.New("connection refused")
+		}
+		start := time.Now()
+		_, unsubscribe := watcher.Subscribe()
+		Eventually(bosh.GetCurrentTasksCallCount, 5*time.Second).Should(BeNumerically(">=", 5))
+		unsubscribe()
+
+		// 20ms, then 40ms, 80ms, 80ms, ... instead of every 20ms. Polls
+		// may come late, but never early.
+		lock.Lock()
+		defer lock.Unlock()
+		for i, earliest := range []time.Duration{20, 60, 140, 220, 300} {
+			Expect(polls[i].Sub(start)).To(BeNumerically(">=", earliest*time.Millisecond))
+		}
+	})
+
+	It("counts the backoff from when a slow poll finished", func() {
+		var lock sync.Mutex
+		starts := []time.Time{}
+		ends := []time.Time{}
+		bosh.GetCurrentTasksStub = func() ([]clients.Task, error) {
+			lock.Lock()
+			starts = append(starts, time.Now())
+			lock.Unlock()
+			time.Sleep(100 * time.Millisecond)
+			lock.Lock()
+			ends = append(ends, time.Now())
+			lock.Unlock()
+			return nil, errors.New("timeout awaiting response headers")
+		}
+		_, unsubscribe := watcher.Subscribe()
+		Eventually(bosh.GetCurrentTasksCallCount, 5*time.Second).Should(BeNumerically(">=", 4))
+		unsubscribe()
+
+		// Polls take longer than the 20ms interval, but each one is still
+		// followed by the backed off 40ms, 80ms and 80ms.
+		lock.Lock()
+		defer lock.Unlock()
+		for i, delay := range []time.Duration{40, 80, 80} {
+			Expect(starts[i+1].Sub(ends[i])).To(BeNumerically(">=", delay*time.Millisecond))
+		}
+	})
+
+	It("waits for a deploy task", func() {
+		Expect(watcher.WaitForDeploy(time.Second, nil)).To(Equal(7))
+
+		bosh.GetCurrentTasksReturns([]clients.Task{{ID: 8, Description: "run errand smoke-tests"}}, nil)
+		Expect(watcher.WaitForDeploy(100*time.Millisecond, nil)).To(Equal(0))
+	})
+})
@@ -18,12 +18,14 @@ package clients
 import (
 	"crypto/tls"
 	"encoding/csv"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"regexp"
 	"strconv"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/spf13/afero"
@@ -35,91 +37,341 @@ type Result struct {
 	StatusCode   int
 	Size         int
 	Error        error
+	ErrorClass   string
 	Success      int
 }
 
 type Prober struct {
-	url    string
-	client http.Client
-	opts   *Opts
-	bosh   Bosh
+	url         string
+	client      http.Client
+	opts        *Opts
+	bosh        Bosh
+	stop        chan struct{}
+	stopOnce    sync.Once
+	baseline    []Result
+	windows     Windows
+	windowsLock sync.Mutex
+	deployments []*WatchedDeployment
+	tasks       *TaskWatcher
+	expectBody  *regexp.Regexp
+	invalid     error
+	sinks       []namedSink
+
+	// outputVersion is the CSV layout the output file is written in.
+	outputVersion int
 }
 
-var FS = afero.NewOsFs()
+type namedSink struct {
+	name string
+	sink Sink
+}
 
-type DeploymentTimes map[int64][]string
+var FS = afero.NewOsFs()
 
 func NewProber(opts *Opts, bosh Bosh) *Prober {
 	transport := &http.Transport{
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: opts.InsecureSkipVerify},
 	}
-	client := http.Client{Transport: transport}
-	prober := Prober{opts.URL, client, opts, bosh}
+	client := http.Client{Transport: transport, Timeout: opts.Timeout}
+	prober := Prober{url: opts.URL, client: client, opts: opts, bosh: bosh, stop: make(chan struct{})}
+	prober.tasks = NewTaskWatcher(bosh, opts)
+	if opts.ExpectBody != "" {
+		expectBody, err := regexp.Compile(opts.ExpectBody)
+		if err != nil {
+			prober.invalid = fmt.Errorf("invalid expected body: %s", err)
+		}
+		prober.expectBody = expectBody
+	}
 
 	return &prober
 }
 
+// Stop ends a running RecordDowntime.
+func (p *Prober) Stop() {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
+}
+
+// Stopped reports whether Stop was called.
+func (p *Prober) Stopped() bool {
+	select {
+	case <-p.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// UseTaskWatcher shares the director polling with others watching tasks on
+// the same director.
+func (p *Prober) UseTaskWatcher(tasks *TaskWatcher) {
+	p.tasks = tasks
+}
+
+// AddSink passes the results and annotations of the next recording to the
+// sink as well, and closes it when the recording ends.
+func (p *Prober) AddSink(name string, sink Sink) {
+	p.sinks = append(p.sinks, namedSink{name: name, sink: sink})
+}
+
+// UseMetrics exposes the results and instance updates of the recording.
+func (p *Prober) UseMetrics(metrics *Metrics) {
+	if metrics != nil {
+		p.AddSink("metrics", metrics.Sink(p.url))
+	}
+}
+
+// WaitForTask returns the ID of the next deployment task on the director,
+// or 0 after the timeout or Stop.
+func (p *Prober) WaitForTask(timeout time.Duration) int {
+	return p.tasks.WaitForDeploy(timeout, p.stop)
+}
+
+// Watch records the deploy tasks of the deployments instead of opts.BoshTask.
+// Recording ends when all of their tasks finished, or any with --until any.
+func (p *Prober) Watch(deployments ...*WatchedDeployment) {
+	p.deployments = append(p.deployments, deployments...)
+}
+
+func (p *Prober) watched() []*WatchedDeployment {
+	if len(p.deployments) > 0 {
+		return p.deployments
+	}
+	if p.opts.BoshTask == "" {
+		return nil
+	}
+	return []*WatchedDeployment{{Bosh: p.bosh, Tasks: p.tasks, taskID: p.opts.BoshTask}}
+}
+
 func (p *Prober) RecordDowntime() error {
+	if p.invalid != nil {
+		return p.invalid
+	}
 
-	/* Ticket starts ticking at instantiation. A minimal
-	   sleep offset is required to ensure that boshCheckTicker
-		 ticks before the prober proberTicker */
-	boshCheckTicker := time.NewTicker(p.opts.Interval)
+	done := make(chan struct{})
+	defer close(done)
+	deployments := p.watched()
+	ended := make(chan *WatchedDeployment)
+	liveAnnotations := make(chan []Annotation)
+	if p.opts.BoshTask != "" {
+		p.MarkDeployStart()
+	}
+	for _, deployment := range deployments {
+		go p.watchDeployment(deployment, ended, done)
+		if p.opts.BoshEventInterval != 0 {
+			go p.streamEvents(deployment, liveAnnotations, done)
+		}
+	}
+
+	/* A task watcher polls first one BoshPollInterval after the
+	   first subscription, then one BoshPollInterval after each poll
+	   finished. A minimal sleep offset makes the proberTicker tick
+	   just after the polls of a responsive director while both use
+	   the same interval. A watcher that was already polling, as in
+	   daemon mode, keeps its own pace */
 	time.Sleep(10 * time.Millisecond)
 
 	proberTicker := time.NewTicker(p.opts.Interval)
 	timeout := make(<-chan time.Time)
-	boshTask := make(chan time.Time)
-
-	boshTaskStr := p.opts.BoshTask
-	if boshTaskStr != "" {
-		go func() {
-			for {
-				select {
-				case <-boshCheckTicker.C:
-					taskId, err := p.bosh.GetCurrentTaskId()
-					if err != nil {
-						log.Println(err)
-					}
-					optsTaskId, err := strconv.Atoi(boshTaskStr)
-					if err != nil {
-						log.Println(err)
-					}
-					if optsTaskId != taskId {
-						boshTask <- time.Now()
-					}
-				}
-			}
-		}()
+
+	recordingStart := time.Now()
+	if len(p.baseline) > 0 {
+		recordingStart = p.baseline[0].Timestamp
 	}
+	defer func() {
+		p.markRecording(recordingStart, time.Now())
+	}()
 
 	if p.opts.Duration != 0 {
 		timeout = time.NewTimer(p.opts.Duration).C
 	}
 
-	outfile, err := FS.Create(p.opts.OutputFile)
+	outfile, first, resumeAfter, err := p.openOutput()
 	if err != nil {
 		return err
 	}
+	if !first.IsZero() {
+		recordingStart = first
+	}
 
-	csvWriter := csv.NewWriter(outfile)
-	defer outfile.Close()
-	csvWriter.Write([]string{"timestamp", "success", "latency", "code", "size", "", "annotation"})
+	recording, err := p.openSinks(outfile)
+	if err != nil {
+		outfile.Close()
+		return err
+	}
+	defer recording.close()
+	outages := newOutageDetector(p.opts.OutagePolicy())
+	var last Result
+	defer func() {
+		if outage := outages.ongoing(last); outage != nil {
+			recording.Outage(*outage)
+		}
+	}()
+	write := func(result Result) {
+		if !resumeAfter.IsZero() {
+			p.addGap(Gap{Start: resumeAfter, End: result.Timestamp})
+			recording.Annotate([]Annotation{gapAnnotation("done")})
+			resumeAfter = time.Time{}
+		}
+		recording.Result(result)
+		last = result
+		started, ended := outages.observe(result)
+		if started != nil {
+			recording.Outage(*started)
+		}
+		if ended != nil {
+			recording.Outage(*ended)
+		}
+	}
+	for _, result := range p.baseline {
+		if !result.Timestamp.After(resumeAfter) {
+			continue
+		}
+		write(result)
+	}
+	endedTasks := 0
 	for {
 		select {
-		case <-boshTask:
-			return nil
+		case deployment := <-ended:
+			endedTasks++
+			if p.opts.Until != "any" && endedTasks < len(deployments) {
+				continue
+			}
+			ended = nil
+			p.MarkDeployEnd()
+			after := p.probeAfter(deployment)
+			if after == 0 {
+				return nil
+			}
+			timeout = time.NewTimer(after).C
+		case annotations := <-liveAnnotations:
+			recording.Annotate(annotations)
 		case <-proberTicker.C:
-			row := getCvsRow(p.Probe())
-			_ = csvWriter.Write(row)
-			csvWriter.Flush()
+			write(p.Probe())
 		case <-timeout:
 			return nil
+		case <-p.stop:
+			return nil
 		}
 	}
 	return nil
 }
 
+// watchDeployment follows the deploy task of the deployment, finding it
+// first if it hasn't started yet, and passes the deployment on once its
+// task ended.
+func (p *Prober) watchDeployment(deployment *WatchedDeployment, ended chan<- *WatchedDeployment, done <-chan struct{}) {
+	updates, unsubscribe := deployment.Tasks.Subscribe()
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-done:
+			return
+		case tasks := <-updates:
+			if deployment.TaskID() == "" {
+				if task, found := deployment.findTask(tasks); found {
+					log.Println(fmt.Sprintf("Found task %d of deployment %s", task.ID, deployment.Label()))
+					deployment.setTaskID(strconv.Itoa(task.ID))
+					p.MarkDeployStart()
+					p.markDeployStart(task.StartedAt)
+				}
+				continue
+			}
+			taskID, err := strconv.Atoi(deployment.TaskID())
+			if err != nil {
+				log.Println(err)
+			}
+			if task, running := runningTask(tasks, taskID); running {
+				// After a restart during the deployment, it started
+				// with the task rather than with this recording.
+				p.markDeployStart(task.StartedAt)
+				continue
+			}
+			select {
+			case ended <- deployment:
+			case <-done:
+			}
+			return
+		}
+	}
+}
+
+// probeAfter returns how long to keep probing after the task ended: the
+// tail, or the grace period if that is longer and the task failed, so that
+// recovery from a failed deploy is recorded.
+func (p *Prober) probeAfter(deployment *WatchedDeployment) time.Duration {
+	if p.opts.FailureGracePeriod <= p.opts.Tail {
+		return p.opts.Tail
+	}
+	taskID := deployment.TaskID()
+	state, err := deployment.Bosh.GetTaskState(taskID)
+	if err != nil {
+		log.Println(err)
+		return p.opts.Tail
+	}
+	if !TaskFailed(state) {
+		return p.opts.Tail
+	}
+	log.Println(fmt.Sprintf("Task %s ended in state %s, probing for another %s", taskID, state, p.opts.FailureGracePeriod))
+	return p.opts.FailureGracePeriod
+}
+
+// streamEvents polls the director for events of the deployment's task while
+// recording and passes on the ones it hasn't seen before. Only the events
+// from the second of the last one on are fetched again.
+func (p *Prober) streamEvents(deployment *WatchedDeployment, annotations chan<- []Annotation, done <-chan struct{}) {
+	ticker := time.NewTicker(p.opts.BoshEventInterval)
+	defer ticker.Stop()
+
+	var since time.Time
+	seen := map[string]int64{}
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			taskID := deployment.TaskID()
+			if taskID == "" {
+				continue
+			}
+			timestamps, err := deployment.Bosh.GetDeploymentTimes(taskID, EventFilter(p.opts.BoshEvents), since)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			timestamps.label(deployment.Director, deployment.Deployment)
+			fresh := []Annotation{}
+			for _, timestamp := range timestamps.Timestamps() {
+				for _, annotation := range timestamps[timestamp] {
+					key := strconv.FormatInt(timestamp, 10) + " " + annotation.String()
+					if _, ok := seen[key]; !ok {
+						seen[key] = timestamp
+						fresh = append(fresh, annotation)
+					}
+				}
+				if at := time.Unix(0, timestamp*int64(time.Millisecond)); at.After(since) {
+					since = at
+				}
+			}
+			for key, timestamp := range seen {
+				if timestamp < unixMillis(since.Truncate(time.Second)) {
+					delete(seen, key)
+				}
+			}
+			if len(fresh) == 0 {
+				continue
+			}
+			select {
+			case annotations <- fresh:
+			case <-done:
+				return
+			}
+		}
+	}
+}
+
 func (p *Prober) AnnotateWithTimestamps(timestamps DeploymentTimes) error {
 
 	annotatedFile, err := FS.Create(p.opts.OutputFile + "-annotated")
@@ -133,18 +385,38 @@ func (p *Prober) AnnotateWithTimestamps(timestamps DeploymentTimes) error {
 		return err
 	}
 
-	csvWriter := csv.NewWriter(annotatedFile)
 	defer annotatedFile.Close()
-	csvReader := csv.NewReader(inputFile)
 	defer inputFile.Close()
 
+	if p.opts.Format == FormatJSONL {
+		err = annotateJSONL(inputFile, annotatedFile, timestamps)
+	} else {
+		err = annotateCsv(inputFile, annotatedFile, timestamps)
+	}
+	if err != nil {
+		return err
+	}
+
+	FS.Rename(p.opts.OutputFile+"-annotated", p.opts.OutputFile)
+	return nil
+}
+
+func annotateCsv(input io.Reader, output io.Writer, timestamps DeploymentTimes) error {
+	csvWriter := csv.NewWriter(output)
+	csvReader := csv.NewReader(input)
+
 	header, err := csvReader.Read()
 	if err != nil {
 		return err
 	}
+	version, err := csvVersion(header)
+	if err != nil {
+		return err
+	}
 	csvReader.FieldsPerRecord = 0
 	csvWriter.Write(header)
 
+	cursor := timestamps.cursor()
 	for {
 		record, err := csvReader.Read()
 		if err == io.EOF {
@@ -154,56 +426,171 @@ func (p *Prober) AnnotateWithTimestamps(timestamps DeploymentTimes) error {
 			return err
 		}
 
-		timestamp, err := strconv.ParseInt(record[0], 10, 64)
+		result, err := parseCsvRow(record, version)
 		if err != nil {
 			return err
 		}
 
-		annotations, exists := timestamps[timestamp]
-
-		if exists {
-			annotationString := strings.Join(annotations, "\n")
-			record = append(record, annotationString)
+		// Annotations streamed during the recording are replaced by the
+		// ones matching the row's timestamp.
+		annotationColumn := len(header) - 1
+		if len(record) > annotationColumn {
+			record = record[:annotationColumn]
+		}
+		if annotations := cursor.upTo(unixMillis(result.Timestamp)); len(annotations) > 0 {
+			record = append(record, joinAnnotations(annotations))
 		}
 		csvWriter.Write(record)
 		csvWriter.Flush()
 	}
-
-	FS.Rename(p.opts.OutputFile+"-annotated", p.opts.OutputFile)
 	return nil
 }
 
-func getCvsRow(result Result) []string {
-	cvsRow := []string{}
-	resultError := ""
-	if result.Error != nil {
-		resultError = result.Error.Error()
+// AnnotateDeployment annotates the recording with the events and stages of
+// the BOSH tasks and summarizes the downtime.
+func (p *Prober) AnnotateDeployment() (Summary, error) {
+	timestamps := DeploymentTimes{}
+	stages := []Stage{}
+	tasks := []TaskResult{}
+	for _, deployment := range p.watched() {
+		taskID := deployment.TaskID()
+		if taskID == "" {
+			log.Println(fmt.Sprintf("No task of deployment %s was recorded", deployment.Label()))
+			continue
+		}
+
+		events, err := deployment.Bosh.GetDeploymentTimes(taskID, EventFilter(p.opts.BoshEvents), time.Time{})
+		if err != nil {
+			log.Println(err)
+		}
+		events.label(deployment.Director, deployment.Deployment)
+		for timestamp, annotations := range events {
+			for _, annotation := range annotations {
+				timestamps.add(timestamp, annotation)
+			}
+		}
+
+		taskStages, err := deployment.Bosh.GetTaskStages(taskID)
+		if err != nil {
+			log.Println(err)
+		}
+		for i := range taskStages {
+			taskStages[i].Director = deployment.Director
+			taskStages[i].Deployment = deployment.Deployment
+		}
+		timestamps.AddStages(taskStages)
+		stages = append(stages, taskStages...)
+
+		state, err := deployment.Bosh.GetTaskState(taskID)
+		if err != nil {
+			log.Println(err)
+		}
+		tasks = append(tasks, TaskResult{Director: deployment.Director, Deployment: deployment.Deployment, TaskID: taskID, State: state})
 	}
-	cvsRow = append(cvsRow, strconv.FormatInt(result.Timestamp.Unix(), 10), strconv.Itoa(result.Success), result.ResponseTime.String(), strconv.Itoa(result.StatusCode), strconv.Itoa(result.Size), resultError)
-	return cvsRow
+
+	windows := p.Windows()
+	timestamps.AddWindows(windows)
+	timestamps.AddGaps(windows.Gaps)
+	if p.opts.Format != FormatJSONL {
+		outages, err := ReadOutages(p.opts.OutputFile, p.opts.OutagePolicy())
+		if err != nil {
+			return Summary{}, err
+		}
+		timestamps.AddOutages(outages)
+	}
+	if err := p.AnnotateWithTimestamps(timestamps); err != nil {
+		return Summary{}, err
+	}
+
+	metadata := Metadata{
+		URL:      p.opts.URL,
+		Interval: p.opts.Interval,
+		Tasks:    tasks,
+		Windows:  windows,
+	}
+	if err := WriteMetadata(p.opts.OutputFile, metadata); err != nil {
+		return Summary{}, err
+	}
+
+	summary, err := p.summarize(stages)
+	summary.Tasks = tasks
+	return summary, err
+}
+
+// Summarize summarizes the downtime of a recording without a BOSH task.
+func (p *Prober) Summarize() (Summary, error) {
+	return p.summarize(nil)
+}
+
+func (p *Prober) summarize(stages []Stage) (Summary, error) {
+	results, err := ReadResults(p.opts.OutputFile)
+	if err != nil {
+		return Summary{}, err
+	}
+	summary := Summarize(results, stages, p.opts.Interval)
+	outages, err := ReadOutages(p.opts.OutputFile, p.opts.OutagePolicy())
+	if err != nil {
+		return Summary{}, err
+	}
+	summary.SetOutages(outages)
+	windows := p.Windows()
+	if !windows.DeployStart.IsZero() {
+		summary.Phases = SummarizePhases(results, windows, outages)
+	}
+	for _, gap := range windows.Gaps {
+		summary.NotRecording += gap.End.Sub(gap.Start)
+	}
+	return summary, nil
 }
 
 func (c *Prober) Probe() Result {
 	start := time.Now()
+	if c.invalid != nil {
+		return Result{Timestamp: start, Error: c.invalid, ErrorClass: ErrorClassOther}
+	}
 	resp, err := c.client.Get(c.url)
 	if err != nil {
-		return Result{Timestamp: start, Error: err}
+		return Result{Timestamp: start, Error: err, ErrorClass: classifyError(err)}
 	}
 	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
 	end := time.Now()
 	if err != nil {
-		return Result{Timestamp: start, Error: err}
+		return Result{Timestamp: start, Error: err, ErrorClass: classifyError(err)}
 	}
 	success := 0
-	if resp.StatusCode == 200 {
+	errorClass := classifyStatus(resp.StatusCode)
+	if c.expectedStatus(resp.StatusCode) {
 		success = 1
+		errorClass = ""
+	}
+	var bodyErr error
+	if success == 1 && c.expectBody != nil && !c.expectBody.Match(body) {
+		success = 0
+		bodyErr = fmt.Errorf("response body does not match %q", c.opts.ExpectBody)
+		errorClass = ErrorClassBodyMismatch
 	}
 	return Result{
 		Timestamp:    start,
 		ResponseTime: end.Sub(start),
 		StatusCode:   resp.StatusCode,
 		Size:         len(body),
+		Error:        bodyErr,
+		ErrorClass:   errorClass,
 		Success:      success,
 	}
 }
+
+// expectedStatus reports whether the status is one of a successful probe,
+// 200 unless configured otherwise.
+func (c *Prober) expectedStatus(status int) bool {
+	if len(c.opts.ExpectStatus) == 0 {
+		return status == http.StatusOK
+	}
+	for _, expected := range c.opts.ExpectStatus {
+		if status == expected {
+			return true
+		}
+	}
+	return false
+}
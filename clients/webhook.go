@@ -0,0 +1,271 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultWebhookTemplate posts a message Slack and compatible chat webhooks
+// understand.
+const DefaultWebhookTemplate = `{"text": {{json .Text}}}`
+
+const (
+	webhookAttempts       = 3
+	webhookAttemptTimeout = 5 * time.Second
+	webhookRetryDelay     = time.Second
+)
+
+// webhookDeliveryTimeout is the longest delivering a notification takes, if
+// every attempt fails.
+func webhookDeliveryTimeout() time.Duration {
+	timeout, delay := time.Duration(0), webhookRetryDelay
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		timeout += webhookAttemptTimeout
+		if attempt < webhookAttempts {
+			timeout += delay
+			delay *= 2
+		}
+	}
+	return timeout
+}
+
+// OutageNotification is the data of the webhook template.
+type OutageNotification struct {
+	// Event is "started" or "ended".
+	Event    string
+	Target   string
+	Outage   Outage
+	Duration time.Duration
+	Error    string
+	// Instances are the BOSH instances being updated at the time.
+	Instances []string
+	// Suppressed counts the notifications left out because of the rate
+	// limit since the previous one.
+	Suppressed int
+	Text       string
+}
+
+// ParseWebhookTemplate parses a payload template. The json function quotes
+// a value as JSON.
+func ParseWebhookTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = DefaultWebhookTemplate
+	}
+	return template.New("webhook").Funcs(template.FuncMap{
+		"json": func(value interface{}) (string, error) {
+			encoded, err := json.Marshal(value)
+			return string(encoded), err
+		},
+	}).Parse(text)
+}
+
+// webhookSink posts a notification when an outage starts and when it ends,
+// at most every minInterval. Notifications coming up in
+// between are combined into the next one, so the last word is always the
+// current state.
+type webhookSink struct {
+	url           string
+	target        string
+	payload       *template.Template
+	minInterval   time.Duration
+	client        http.Client
+	instances     map[string]bool
+	notifications chan OutageNotification
+	done          chan struct{}
+}
+
+func newWebhookSink(opts *Opts, target string) (*webhookSink, error) {
+	payload, err := ParseWebhookTemplate(opts.WebhookTemplate)
+	if err != nil {
+		return nil, err
+	}
+	sink := &webhookSink{
+		url:           opts.WebhookURL,
+		target:        target,
+		payload:       payload,
+		minInterval:   opts.WebhookMinInterval,
+		client:        http.Client{Timeout: webhookAttemptTimeout},
+		instances:     map[string]bool{},
+		notifications: make(chan OutageNotification, sinkBacklog),
+		done:          make(chan struct{}),
+	}
+	go sink.deliver()
+	return sink, nil
+}
+
+func (s *webhookSink) Annotate(annotations []Annotation) error {
+	for _, annotation := range annotations {
+		if annotation.ObjectType != "instance" || annotation.ObjectName == "" {
+			continue
+		}
+		instance := annotation.ObjectName
+		if label := deploymentLabel(annotation.Director, annotation.Deployment); label != "" {
+			instance = label + ": " + instance
+		}
+		switch annotation.Phase {
+		case "start":
+			s.instances[instance] = true
+		case "done":
+			delete(s.instances, instance)
+		}
+	}
+	return nil
+}
+
+func (s *webhookSink) Result(result Result) error {
+	return nil
+}
+
+// Outage notifies of outages starting and ending. It keeps quiet about
+// the outage a recording ended in, as it's not over.
+func (s *webhookSink) Outage(outage Outage) error {
+	if outage.End.IsZero() {
+		s.notify("started", outage, time.Since(outage.Start))
+	} else if !outage.Ongoing {
+		s.notify("ended", outage, outage.Duration())
+	}
+	return nil
+}
+
+func (s *webhookSink) notify(event string, outage Outage, duration time.Duration) {
+	instances := []string{}
+	for instance := range s.instances {
+		instances = append(instances, instance)
+	}
+	sort.Strings(instances)
+	s.notifications <- OutageNotification{
+		Event:     event,
+		Target:    s.target,
+		Outage:    outage,
+		Duration:  duration,
+		Error:     outage.Error,
+		Instances: instances,
+	}
+}
+
+// Close delivers the notifications still held back by the rate limit.
+func (s *webhookSink) Close() error {
+	close(s.notifications)
+	<-s.done
+	return nil
+}
+
+// closeTimeout allows for finishing the delivery in progress and then
+// delivering the last notification, which tells the outage ended.
+func (s *webhookSink) closeTimeout() time.Duration {
+	return 2*webhookDeliveryTimeout() + sinkCloseTimeout
+}
+
+func (s *webhookSink) deliver() {
+	defer close(s.done)
+	var pending *OutageNotification
+	var wait <-chan time.Time
+	suppressed := 0
+	lastSent := time.Time{}
+	for {
+		select {
+		case notification, ok := <-s.notifications:
+			if !ok {
+				if pending != nil {
+					pending.Suppressed = suppressed
+					s.post(*pending)
+				}
+				return
+			}
+			if pending != nil {
+				suppressed++
+			}
+			pending = &notification
+		case <-wait:
+			wait = nil
+		}
+		if pending == nil || wait != nil {
+			continue
+		}
+		if untilAllowed := lastSent.Add(s.minInterval).Sub(time.Now()); untilAllowed > 0 {
+			wait = time.After(untilAllowed)
+			continue
+		}
+		pending.Suppressed = suppressed
+		s.post(*pending)
+		lastSent = time.Now()
+		pending, suppressed = nil, 0
+	}
+}
+
+func (s *webhookSink) post(notification OutageNotification) {
+	notification.Text = notification.text()
+	payload := bytes.Buffer{}
+	if err := s.payload.Execute(&payload, notification); err != nil {
+		log.Println(fmt.Sprintf("Rendering the webhook payload failed: %s", err))
+		return
+	}
+
+	delay := webhookRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := s.send(payload.Bytes())
+		if err == nil {
+			return
+		}
+		if attempt == webhookAttempts {
+			log.Println(fmt.Sprintf("Posting the outage to the webhook failed, giving up: %s", err))
+			return
+		}
+		log.Println(fmt.Sprintf("Posting the outage to the webhook failed, retrying in %s: %s", delay, err))
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func (s *webhookSink) send(payload []byte) error {
+	response, err := s.client.Post(s.url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status %d", response.StatusCode)
+	}
+	return nil
+}
+
+func (n OutageNotification) text() string {
+	var text string
+	if n.Event == "started" {
+		text = fmt.Sprintf("%s is down since %s", n.Target, n.Outage.Start.Format("15:04:05"))
+		if n.Error != "" {
+			text += ": " + n.Error
+		}
+	} else {
+		text = fmt.Sprintf("%s is up again after %s of downtime", n.Target, n.Duration)
+	}
+	if len(n.Instances) > 0 {
+		text += fmt.Sprintf(", BOSH is updating %s", strings.Join(n.Instances, ", "))
+	}
+	if n.Suppressed > 0 {
+		text += fmt.Sprintf(" (%d earlier notifications left out)", n.Suppressed)
+	}
+	return text
+}
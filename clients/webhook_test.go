@@ -0,0 +1,121 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/pivotal-cf/downtimer/clients"
+	"github.com/pivotal-cf/downtimer/clients/clientsfakes"
+	"github.com/spf13/afero"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Webhook", func() {
+	var opts clients.Opts
+	var target, webhook *httptest.Server
+	var lock sync.Mutex
+	var posts []string
+
+	received := func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]string{}, posts...)
+	}
+
+	BeforeEach(func() {
+		clients.FS = afero.NewMemMapFs()
+		posts = nil
+		downUntil := time.Now().Add(100 * time.Millisecond)
+		target = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if time.Now().Before(downUntil) {
+				http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			}
+		}))
+		webhook = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			lock.Lock()
+			defer lock.Unlock()
+			posts = append(posts, string(body))
+		}))
+		opts = clients.Opts{
+			URL:             target.URL,
+			OutputFile:      "/output.csv",
+			Duration:        300 * time.Millisecond,
+			Interval:        10 * time.Millisecond,
+			OutageFailures:  2,
+			OutageSuccesses: 2,
+			WebhookURL:      webhook.URL,
+		}
+	})
+
+	AfterEach(func() {
+		target.Close()
+		webhook.Close()
+	})
+
+	It("posts when an outage starts and when it ends", func() {
+		Expect(clients.NewProber(&opts, new(clientsfakes.FakeBosh)).RecordDowntime()).To(Succeed())
+
+		Expect(received()).To(HaveLen(2))
+		var started, ended map[string]string
+		Expect(json.Unmarshal([]byte(received()[0]), &started)).To(Succeed())
+		Expect(json.Unmarshal([]byte(received()[1]), &ended)).To(Succeed())
+		Expect(started["text"]).To(MatchRegexp(`is down since \d\d:\d\d:\d\d: status 503$`))
+		Expect(ended["text"]).To(ContainSubstring("is up again after"))
+	})
+
+	It("renders a custom template and holds back notifications within the minimum interval", func() {
+		opts.WebhookTemplate = `{"event": {{json .Event}}, "failures": {{.Outage.Failures}}}`
+		opts.WebhookMinInterval = time.Hour
+		Expect(clients.NewProber(&opts, new(clientsfakes.FakeBosh)).RecordDowntime()).To(Succeed())
+
+		Expect(received()).To(HaveLen(2))
+		Expect(received()[0]).To(Equal(`{"event": "started", "failures": 2}`))
+		Expect(received()[1]).To(MatchRegexp(`{"event": "ended", "failures": \d+}`))
+	})
+
+	It("delivers the end of the outage even if retrying takes longer than other sinks may", func() {
+		failures := 5
+		webhook.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			lock.Lock()
+			defer lock.Unlock()
+			if failures > 0 {
+				failures--
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			posts = append(posts, string(body))
+		})
+		Expect(clients.NewProber(&opts, new(clientsfakes.FakeBosh)).RecordDowntime()).To(Succeed())
+
+		Expect(received()).To(HaveLen(1))
+		Expect(received()[0]).To(ContainSubstring("is up again after"))
+	})
+
+	It("rejects a template that does not parse", func() {
+		_, err := clients.ParseWebhookTemplate("{{.Text")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,141 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package clients
+
+import "time"
+
+// Windows divides a recording into the baseline before the deployment, the
+// deployment itself and the tail after it.
+type Windows struct {
+	Start       time.Time `json:"start"`
+	DeployStart time.Time `json:"deploy_start"`
+	DeployEnd   time.Time `json:"deploy_end"`
+	End         time.Time `json:"end"`
+	Gaps        []Gap     `json:"gaps,omitempty"`
+}
+
+const (
+	PhaseBaseline = "baseline"
+	PhaseDeploy   = "deploy"
+	PhaseTail     = "tail"
+)
+
+func (w Windows) Phase(t time.Time) string {
+	if !w.DeployStart.IsZero() && t.Before(w.DeployStart) {
+		return PhaseBaseline
+	}
+	if !w.DeployEnd.IsZero() && t.After(w.DeployEnd) {
+		return PhaseTail
+	}
+	return PhaseDeploy
+}
+
+// bounds returns when the phase started and ended, with zero times for no
+// bound.
+func (w Windows) bounds(phase string) (start, end time.Time) {
+	switch phase {
+	case PhaseBaseline:
+		return time.Time{}, w.DeployStart
+	case PhaseTail:
+		return w.DeployEnd, time.Time{}
+	}
+	return w.DeployStart, w.DeployEnd
+}
+
+func (d DeploymentTimes) AddWindows(windows Windows) {
+	if windows.DeployStart.IsZero() {
+		return
+	}
+	if windows.Start.Before(windows.DeployStart) {
+		d.add(unixMillis(windows.Start), Annotation{ObjectType: "window", ObjectName: PhaseBaseline, Phase: "start"})
+	}
+	d.add(unixMillis(windows.DeployStart), Annotation{ObjectType: "window", ObjectName: PhaseDeploy, Phase: "start"})
+	if windows.DeployEnd.IsZero() {
+		return
+	}
+	d.add(unixMillis(windows.DeployEnd), Annotation{ObjectType: "window", ObjectName: PhaseDeploy, Phase: "done"})
+	if windows.End.After(windows.DeployEnd) {
+		d.add(unixMillis(windows.End), Annotation{ObjectType: "window", ObjectName: PhaseTail, Phase: "done"})
+	}
+}
+
+// RecordBaseline waits for the deployment task, probing in the meantime. The
+// last opts.Baseline of results are written ahead of the recording. It
+// returns 0 if the task didn't show up before the timeout or Stop.
+func (p *Prober) RecordBaseline(timeout time.Duration) int {
+	taskID := make(chan int, 1)
+	go func() {
+		taskID <- p.WaitForTask(timeout)
+	}()
+
+	var probes <-chan time.Time
+	if p.opts.Baseline != 0 {
+		ticker := time.NewTicker(p.opts.Interval)
+		defer ticker.Stop()
+		probes = ticker.C
+	}
+	for {
+		select {
+		case id := <-taskID:
+			return id
+		case <-probes:
+			result := p.Probe()
+			p.baseline = append(p.baseline, result)
+			for len(p.baseline) > 0 && result.Timestamp.Sub(p.baseline[0].Timestamp) > p.opts.Baseline {
+				p.baseline = p.baseline[1:]
+			}
+		}
+	}
+}
+
+func (p *Prober) MarkDeployStart() {
+	p.markDeployStart(time.Now())
+}
+
+// markDeployStart moves the start of the deployment back to start.
+func (p *Prober) markDeployStart(start time.Time) {
+	p.windowsLock.Lock()
+	defer p.windowsLock.Unlock()
+	if start.IsZero() {
+		return
+	}
+	if p.windows.DeployStart.IsZero() || start.Before(p.windows.DeployStart) {
+		p.windows.DeployStart = start
+	}
+}
+
+func (p *Prober) MarkDeployEnd() {
+	p.windowsLock.Lock()
+	defer p.windowsLock.Unlock()
+	if p.windows.DeployEnd.IsZero() {
+		p.windows.DeployEnd = time.Now()
+	}
+}
+
+func (p *Prober) Windows() Windows {
+	p.windowsLock.Lock()
+	defer p.windowsLock.Unlock()
+	return p.windows
+}
+
+func (p *Prober) markRecording(start, end time.Time) {
+	p.windowsLock.Lock()
+	defer p.windowsLock.Unlock()
+	if p.windows.Start.IsZero() || start.Before(p.windows.Start) {
+		p.windows.Start = start
+	}
+	p.windows.End = end
+}
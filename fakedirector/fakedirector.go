@@ -0,0 +1,332 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+// Package fakedirector serves the parts of the BOSH director and UAA APIs
+// downtimer uses from scripted data, so the binary can be tested end to end
+// without a real director.
+package fakedirector
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	Client       = "downtimer"
+	ClientSecret = "downtimer-secret"
+	accessToken  = "fake-access-token"
+)
+
+// Task is reported as running between Start and End after the director
+// was started, and in its final State afterwards.
+type Task struct {
+	ID          int
+	Description string
+	Deployment  string
+	State       string
+	Start       time.Duration
+	End         time.Duration
+	EventOutput []TaskEvent
+}
+
+// TaskEvent is a line of a task's event output, At after the director
+// was started.
+type TaskEvent struct {
+	At    time.Duration
+	Stage string
+	Tags  []string
+	Task  string
+	State string
+}
+
+// Event is a director event, listed once At has passed since the director
+// was started.
+type Event struct {
+	At         time.Duration
+	ID         string
+	ParentID   string
+	TaskID     string
+	Action     string
+	ObjectType string
+	ObjectName string
+	Deployment string
+	Error      string
+}
+
+type Script struct {
+	Tasks  []Task
+	Events []Event
+	// UAA makes the director require tokens from a fake UAA instead of
+	// basic auth.
+	UAA bool
+	// TokenLifetime makes the director reject UAA tokens once they are
+	// older, forever by default.
+	TokenLifetime time.Duration
+}
+
+type Director struct {
+	script   Script
+	started  time.Time
+	server   *httptest.Server
+	uaa      *httptest.Server
+	lock     sync.Mutex
+	requests []string
+	tokens   map[string]time.Time
+}
+
+func New(script Script) *Director {
+	d := &Director{script: script, started: time.Now(), tokens: map[string]time.Time{}}
+	if script.UAA {
+		d.uaa = httptest.NewTLSServer(http.HandlerFunc(d.token))
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/info", d.info)
+	mux.HandleFunc("/tasks", d.authenticated(d.currentTasks))
+	mux.HandleFunc("/tasks/", d.authenticated(d.task))
+	mux.HandleFunc("/events", d.authenticated(d.events))
+	d.server = httptest.NewTLSServer(d.recorded(mux))
+	return d
+}
+
+func (d *Director) URL() string {
+	return d.server.URL
+}
+
+// CACert returns the PEM encoded certificate of the director and UAA.
+func (d *Director) CACert() string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: d.server.TLS.Certificates[0].Certificate[0]}))
+}
+
+// TokensIssued returns how many tokens the fake UAA issued.
+func (d *Director) TokensIssued() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return len(d.tokens)
+}
+
+// Requests returns the method and path of every request the director served.
+func (d *Director) Requests() []string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return append([]string{}, d.requests...)
+}
+
+func (d *Director) Close() {
+	d.server.Close()
+	if d.uaa != nil {
+		d.uaa.Close()
+	}
+}
+
+func (d *Director) recorded(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.lock.Lock()
+		d.requests = append(d.requests, r.Method+" "+r.URL.Path)
+		d.lock.Unlock()
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func (d *Director) isAuthenticated(r *http.Request) bool {
+	if d.script.UAA {
+		d.lock.Lock()
+		defer d.lock.Unlock()
+		issued, ok := d.tokens[strings.TrimPrefix(r.Header.Get("Authorization"), "bearer ")]
+		return ok && (d.script.TokenLifetime == 0 || time.Since(issued) < d.script.TokenLifetime)
+	}
+	client, secret, ok := r.BasicAuth()
+	return ok && client == Client && secret == ClientSecret
+}
+
+func (d *Director) authenticated(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !d.isAuthenticated(r) {
+			http.Error(w, "Not authorized", http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func (d *Director) info(w http.ResponseWriter, r *http.Request) {
+	auth := map[string]interface{}{"type": "basic", "options": map[string]interface{}{}}
+	if d.script.UAA {
+		auth = map[string]interface{}{"type": "uaa", "options": map[string]interface{}{"url": d.uaa.URL}}
+	}
+	user := ""
+	if d.isAuthenticated(r) {
+		user = Client
+	}
+	writeJSON(w, map[string]interface{}{
+		"name":                "fake-director",
+		"uuid":                "fake-director-uuid",
+		"version":             "262.0.0 (00000000)",
+		"user":                user,
+		"cpi":                 "fake-cpi",
+		"user_authentication": auth,
+	})
+}
+
+func (d *Director) token(w http.ResponseWriter, r *http.Request) {
+	client, secret, ok := r.BasicAuth()
+	if r.URL.Path != "/oauth/token" || !ok || client != Client || secret != ClientSecret {
+		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+	d.lock.Lock()
+	token := fmt.Sprintf("%s-%d", accessToken, len(d.tokens)+1)
+	d.tokens[token] = time.Now()
+	d.lock.Unlock()
+	writeJSON(w, map[string]interface{}{
+		"access_token": token,
+		"token_type":   "bearer",
+		"expires_in":   3600,
+	})
+}
+
+func (d *Director) elapsed() time.Duration {
+	return time.Since(d.started)
+}
+
+func (d *Director) state(task Task) string {
+	elapsed := d.elapsed()
+	switch {
+	case elapsed < task.Start:
+		return "queued"
+	case elapsed < task.End:
+		return "processing"
+	case task.State == "":
+		return "done"
+	default:
+		return task.State
+	}
+}
+
+func (d *Director) taskResponse(task Task) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          task.ID,
+		"state":       d.state(task),
+		"description": task.Description,
+		"deployment":  task.Deployment,
+		"user":        Client,
+		"result":      "",
+		"context_id":  "",
+		"started_at":  d.started.Add(task.Start).Unix(),
+		"timestamp":   time.Now().Unix(),
+	}
+}
+
+func (d *Director) currentTasks(w http.ResponseWriter, r *http.Request) {
+	tasks := []map[string]interface{}{}
+	for _, task := range d.script.Tasks {
+		state := d.state(task)
+		if state == "processing" || state == "queued" {
+			tasks = append(tasks, d.taskResponse(task))
+		}
+	}
+	writeJSON(w, tasks)
+}
+
+func (d *Director) task(w http.ResponseWriter, r *http.Request) {
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, "/tasks/"), "/")
+	id, err := strconv.Atoi(path[0])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	for _, task := range d.script.Tasks {
+		if task.ID != id {
+			continue
+		}
+		if len(path) == 1 {
+			writeJSON(w, d.taskResponse(task))
+			return
+		}
+		if path[1] == "output" && r.URL.Query().Get("type") == "event" {
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(d.eventOutput(task)))
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+func (d *Director) eventOutput(task Task) []byte {
+	output := bytes.Buffer{}
+	for _, event := range task.EventOutput {
+		if event.At > d.elapsed() {
+			continue
+		}
+		line, _ := json.Marshal(map[string]interface{}{
+			"time":     d.started.Add(event.At).Unix(),
+			"stage":    event.Stage,
+			"tags":     event.Tags,
+			"total":    1,
+			"task":     event.Task,
+			"index":    1,
+			"state":    event.State,
+			"progress": 100,
+		})
+		output.Write(line)
+		output.WriteString("\n")
+	}
+	return output.Bytes()
+}
+
+func (d *Director) events(w http.ResponseWriter, r *http.Request) {
+	taskID := r.URL.Query().Get("task")
+	after, _ := strconv.ParseInt(r.URL.Query().Get("after_time"), 10, 64)
+	events := []map[string]interface{}{}
+	// The director lists the most recent events first.
+	for i := len(d.script.Events) - 1; i >= 0; i-- {
+		event := d.script.Events[i]
+		if event.At > d.elapsed() || (taskID != "" && event.TaskID != taskID) {
+			continue
+		}
+		if after != 0 && d.started.Add(event.At).Unix() <= after {
+			continue
+		}
+		events = append(events, map[string]interface{}{
+			"id":          event.ID,
+			"parent_id":   event.ParentID,
+			"timestamp":   d.started.Add(event.At).Unix(),
+			"user":        Client,
+			"action":      event.Action,
+			"object_type": event.ObjectType,
+			"object_name": event.ObjectName,
+			"task":        event.TaskID,
+			"deployment":  event.Deployment,
+			"instance":    event.ObjectName,
+			"context":     map[string]interface{}{},
+			"error":       event.Error,
+		})
+	}
+	writeJSON(w, events)
+}
+
+func writeJSON(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		http.Error(w, fmt.Sprint(err), http.StatusInternalServerError)
+	}
+}
@@ -16,12 +16,21 @@ limitations under the License. */
 package main_test
 
 import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"os/exec"
+	"strings"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gbytes"
 	"github.com/onsi/gomega/gexec"
+	"github.com/pivotal-cf/downtimer/fakedirector"
 )
 
 var _ = Describe("Downtimer", func() {
@@ -44,6 +53,355 @@ var _ = Describe("Downtimer", func() {
 		})
 	})
 
+	Describe("recording a deployment", func() {
+		var (
+			director *fakedirector.Director
+			app      *httptest.Server
+			output   string
+			uaa      bool
+			lifetime time.Duration
+			state    string
+		)
+
+		BeforeEach(func() {
+			uaa = false
+			lifetime = 0
+			state = "done"
+			app = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintf(w, "I'm alive!")
+			}))
+			outputFile, err := ioutil.TempFile("", "downtimer-integ")
+			Expect(err).NotTo(HaveOccurred())
+			outputFile.Close()
+			output = outputFile.Name()
+		})
+
+		JustBeforeEach(func() {
+			director = fakedirector.New(fakedirector.Script{
+				UAA:           uaa,
+				TokenLifetime: lifetime,
+				Tasks: []fakedirector.Task{{
+					ID:          42,
+					Description: "create deployment",
+					Deployment:  "cf",
+					State:       state,
+					Start:       0,
+					End:         10 * time.Second,
+					EventOutput: []fakedirector.TaskEvent{
+						{At: 6 * time.Second, Stage: "Updating instance", Tags: []string{"router"}, Task: "router/abc (0) (canary)", State: "started"},
+						{At: 8 * time.Second, Stage: "Updating instance", Tags: []string{"router"}, Task: "router/abc (0) (canary)", State: "finished"},
+					},
+				}},
+				// downtimer looks for the task every 5s, so it starts
+				// recording after 5s at the latest.
+				Events: []fakedirector.Event{
+					{At: 6 * time.Second, ID: "1", TaskID: "42", Action: "update", ObjectType: "instance", ObjectName: "router/abc", Deployment: "cf"},
+					{At: 8 * time.Second, ID: "2", ParentID: "1", TaskID: "42", Action: "update", ObjectType: "instance", ObjectName: "router/abc", Deployment: "cf"},
+				},
+			})
+		})
+
+		AfterEach(func() {
+			director.Close()
+			app.Close()
+			os.Remove(output)
+			os.Remove(output + ".json")
+		})
+
+		record := func() {
+			command := exec.Command(binaryPath,
+				"-u", app.URL,
+				"-i", "500ms",
+				"-o", output,
+				"-b", director.URL(),
+				"-U", fakedirector.Client,
+				"-P", fakedirector.ClientSecret,
+				"-c", director.CACert(),
+				"--event-interval", "1s",
+			)
+			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).ToNot(HaveOccurred())
+			if state == "done" {
+				Eventually(session, 20).Should(gexec.Exit(0))
+			} else {
+				Eventually(session, 20).Should(gexec.Exit(5))
+			}
+			Expect(session.Err).To(gbytes.Say("Task 42 finished in state " + state))
+			Expect(session.Err).To(gbytes.Say("0 of [0-9]+ probes failed"))
+
+			metadata, err := ioutil.ReadFile(output + ".json")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(metadata)).To(ContainSubstring(`"state": "` + state + `"`))
+
+			recording, err := ioutil.ReadFile(output)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(recording)).To(ContainSubstring("update instance router/abc start"))
+			Expect(string(recording)).To(ContainSubstring("update instance router/abc done"))
+			Expect(string(recording)).To(ContainSubstring("stage Updating instance router (canary) done"))
+			Expect(director.Requests()).To(ContainElement("GET /events"))
+		}
+
+		It("waits for the deployment task, records it and annotates the events", record)
+
+		Context("when the deployment fails", func() {
+			BeforeEach(func() {
+				state = "error"
+			})
+
+			It("exits with a distinct exit code", record)
+		})
+
+		Context("when the director uses UAA", func() {
+			BeforeEach(func() {
+				uaa = true
+			})
+
+			It("authenticates with a client token", record)
+
+			Context("when tokens expire during the recording", func() {
+				BeforeEach(func() {
+					lifetime = 3 * time.Second
+				})
+
+				It("renews the token and keeps recording", func() {
+					record()
+					Expect(director.TokensIssued()).To(BeNumerically(">", 1))
+				})
+			})
+		})
+	})
+
+	Describe("run command", func() {
+		It("records while the command runs and passes its exit code through", func() {
+			command := exec.Command(binaryPath, "-u", "http://127.0.0.1:1", "-i", "100ms",
+				"run", "--", "sh", "-c", "echo Task 42; sleep 1; exit 3")
+			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session.Err).Should(gbytes.Say("Task 42"))
+			Eventually(session, 5).Should(gexec.Exit(3))
+			Expect(session.Out).To(gbytes.Say("version,timestamp_ms,success"))
+		})
+
+		It("exits immediately on a second signal", func() {
+			command := exec.Command(binaryPath, "-u", "http://127.0.0.1:1", "-i", "100ms",
+				"run", "--", "sh", "-c", "trap '' INT; echo started; exec sleep 10 >/dev/null 2>&1")
+			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session.Err).Should(gbytes.Say("started"))
+			session.Interrupt()
+			Eventually(session.Err).Should(gbytes.Say("finishing the recording"))
+			Consistently(session, 500*time.Millisecond).ShouldNot(gexec.Exit())
+			session.Interrupt()
+			Eventually(session).Should(gexec.Exit(130))
+		})
+
+		It("finishes the recording when interrupted during the baseline", func() {
+			command := exec.Command(binaryPath, "-u", "http://127.0.0.1:1", "-i", "100ms", "--baseline", "10s",
+				"run", "--", "sh", "-c", "echo ran")
+			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session.Err).Should(gbytes.Say("Recording a baseline"))
+			session.Interrupt()
+			Eventually(session, 5).Should(gexec.Exit(130))
+			Expect(session.Err).To(gbytes.Say("Interrupted before running the command"))
+			Expect(session.Err).NotTo(gbytes.Say("ran"))
+			Expect(session.Out).To(gbytes.Say("version,timestamp_ms,success"))
+		})
+
+		It("passes the signal a command was killed by through", func() {
+			command := exec.Command(binaryPath, "-u", "http://127.0.0.1:1", "-i", "100ms",
+				"run", "--", "sh", "-c", "kill -TERM $$")
+			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session, 5).Should(gexec.Exit(128 + 15))
+		})
+
+		It("requires a command", func() {
+			command := exec.Command(binaryPath, "-u", "http://127.0.0.1:1", "run")
+			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session.Err).Should(gbytes.Say("no command given to run"))
+			Eventually(session).Should(gexec.Exit(1))
+		})
+	})
+
+	Describe("signals", func() {
+		It("finishes the recording on SIGINT", func() {
+			outputFile, err := ioutil.TempFile("", "downtimer-integ")
+			Expect(err).NotTo(HaveOccurred())
+			outputFile.Close()
+			defer os.Remove(outputFile.Name())
+
+			command := exec.Command(binaryPath, "-u", "http://127.0.0.1:1", "-i", "100ms", "-o", outputFile.Name(), "--slo-max-downtime", "1h")
+			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).ToNot(HaveOccurred())
+			time.Sleep(time.Second)
+			session.Interrupt()
+			Eventually(session, 5).Should(gexec.Exit(0))
+			Expect(session.Err).To(gbytes.Say("probes failed"))
+
+			recording, err := ioutil.ReadFile(outputFile.Name())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(recording)).To(ContainSubstring("connection refused"))
+		})
+	})
+
+	Describe("appending", func() {
+		It("continues an interrupted recording", func() {
+			outputFile, err := ioutil.TempFile("", "downtimer-integ")
+			Expect(err).NotTo(HaveOccurred())
+			outputFile.Close()
+			defer os.Remove(outputFile.Name())
+
+			for i := 0; i < 2; i++ {
+				command := exec.Command(binaryPath, "-u", "http://127.0.0.1:1", "-d", "1s", "-i", "200ms", "-o", outputFile.Name(), "--append")
+				session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+				Expect(err).ToNot(HaveOccurred())
+				Eventually(session, 5).Should(gexec.Exit(0))
+			}
+
+			recording, err := ioutil.ReadFile(outputFile.Name())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strings.Count(string(recording), "version,timestamp_ms")).To(Equal(1))
+			Expect(string(recording)).To(ContainSubstring("window not recording done"))
+		})
+
+		It("refuses to append to something else", func() {
+			outputFile, err := ioutil.TempFile("", "downtimer-integ")
+			Expect(err).NotTo(HaveOccurred())
+			outputFile.WriteString("name,value\n")
+			outputFile.Close()
+			defer os.Remove(outputFile.Name())
+
+			command := exec.Command(binaryPath, "-u", "http://127.0.0.1:1", "-d", "1s", "-o", outputFile.Name(), "--append")
+			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session, 5).Should(gexec.Exit(1))
+			Expect(session.Err).To(gbytes.Say("unexpected header"))
+		})
+	})
+
+	Describe("sinks", func() {
+		It("prints the results along with the recording", func() {
+			command := exec.Command(binaryPath, "-u", "http://127.0.0.1:1", "-d", "1s", "-i", "200ms", "-o", "/dev/null", "--sink", "pretty")
+			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session, 5).Should(gexec.Exit(0))
+			Expect(session.Err).To(gbytes.Say(`\d\d:\d\d:\d\d\.\d{3} DOWN connect_refused: .*connection refused`))
+		})
+	})
+
+	Describe("junit", func() {
+		It("writes a JUnit report with the downtime as failure", func() {
+			outputFile, err := ioutil.TempFile("", "downtimer-integ")
+			Expect(err).NotTo(HaveOccurred())
+			outputFile.Close()
+			defer os.Remove(outputFile.Name())
+			junitFile := outputFile.Name() + ".xml"
+			defer os.Remove(junitFile)
+
+			command := exec.Command(binaryPath, "-u", "http://127.0.0.1:1", "-d", "1s", "-i", "200ms", "-o", outputFile.Name(), "--junit", junitFile)
+			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session, 5).Should(gexec.Exit(0))
+
+			report, err := ioutil.ReadFile(junitFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(report)).To(ContainSubstring(`<testsuite name="http://127.0.0.1:1" tests="1" failures="1"`))
+			Expect(string(report)).To(ContainSubstring("connection refused"))
+		})
+	})
+
+	Describe("report command", func() {
+		It("turns a recording into an HTML file without probing", func() {
+			outputFile, err := ioutil.TempFile("", "downtimer-integ")
+			Expect(err).NotTo(HaveOccurred())
+			outputFile.Close()
+			defer os.Remove(outputFile.Name())
+			reportFile := outputFile.Name() + ".html"
+			defer os.Remove(reportFile)
+
+			command := exec.Command(binaryPath, "-u", "http://127.0.0.1:1", "-d", "1s", "-i", "200ms", "-o", outputFile.Name())
+			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session, 5).Should(gexec.Exit(0))
+
+			command = exec.Command(binaryPath, "report", outputFile.Name(), reportFile)
+			session, err = gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session, 5).Should(gexec.Exit(0))
+
+			report, err := ioutil.ReadFile(reportFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(report)).To(ContainSubstring("<svg"))
+			Expect(string(report)).To(ContainSubstring("connection refused"))
+		})
+
+		It("requires a recording", func() {
+			command := exec.Command(binaryPath, "report")
+			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session, 5).Should(gexec.Exit(1))
+			Expect(session.Err).To(gbytes.Say("report takes a recording"))
+		})
+	})
+
+	Describe("compare command", func() {
+		It("fails if the new recording has too much more downtime", func() {
+			recordings := []string{}
+			for _, duration := range []string{"400ms", "1s"} {
+				outputFile, err := ioutil.TempFile("", "downtimer-integ")
+				Expect(err).NotTo(HaveOccurred())
+				outputFile.Close()
+				defer os.Remove(outputFile.Name())
+				recordings = append(recordings, outputFile.Name())
+
+				command := exec.Command(binaryPath, "-u", "http://127.0.0.1:1", "-d", duration, "-i", "100ms", "-o", outputFile.Name())
+				session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+				Expect(err).ToNot(HaveOccurred())
+				Eventually(session, 5).Should(gexec.Exit(0))
+			}
+
+			command := exec.Command(binaryPath, "-i", "100ms", "compare", recordings[0], recordings[1])
+			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session, 5).Should(gexec.Exit(0))
+			Expect(session.Out).To(gbytes.Say("downtime"))
+
+			command = exec.Command(binaryPath, "-i", "100ms", "--max-downtime-increase", "200ms", "compare", recordings[0], recordings[1])
+			session, err = gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session, 5).Should(gexec.Exit(7))
+			Expect(session.Err).To(gbytes.Say("The downtime increased by"))
+		})
+	})
+
+	Describe("metrics", func() {
+		It("serves Prometheus metrics while recording", func() {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).ToNot(HaveOccurred())
+			address := listener.Addr().String()
+			listener.Close()
+
+			command := exec.Command(binaryPath, "-u", "http://127.0.0.1:1", "-d", "3s", "-i", "100ms", "-o", "/dev/null", "--metrics-address", address)
+			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			Expect(err).ToNot(HaveOccurred())
+			defer session.Kill()
+
+			scrape := func() string {
+				response, err := http.Get("http://" + address + "/metrics")
+				if err != nil {
+					return ""
+				}
+				defer response.Body.Close()
+				body, _ := ioutil.ReadAll(response.Body)
+				return string(body)
+			}
+			Eventually(scrape, 2).Should(ContainSubstring(`downtimer_up{target="http://127.0.0.1:1"} 0`))
+			Eventually(scrape, 2).Should(MatchRegexp(`downtimer_probe_failures_total\{target="http://127.0.0.1:1"\} [1-9]`))
+		})
+	})
+
 	Describe("commandline opts", func() {
 		It("returns 1 on invalid params", func() {
 			command := exec.Command(binaryPath, "invalid", "input")
@@ -74,5 +432,47 @@ var _ = Describe("Downtimer", func() {
 				Eventually(session).ShouldNot(gexec.Exit())
 			})
 		})
+
+		Context("when a config file is given", func() {
+			var configFile string
+
+			BeforeEach(func() {
+				file, err := ioutil.TempFile("", "downtimer-config")
+				Expect(err).NotTo(HaveOccurred())
+				_, err = file.WriteString(`target:
+  url: ${DOWNTIMER_TEST_URL}
+  interval: 100ms
+recording:
+  duration: 1h
+slo:
+  min_availability: 99
+`)
+				Expect(err).NotTo(HaveOccurred())
+				file.Close()
+				configFile = file.Name()
+			})
+
+			AfterEach(func() {
+				os.Remove(configFile)
+			})
+
+			It("uses its settings, overridden by flags, and fails on SLO breaches", func() {
+				command := exec.Command(binaryPath, "--config", configFile, "-d", "1s", "-o", configFile+".csv")
+				defer os.Remove(configFile + ".csv")
+				command.Env = append(os.Environ(), "DOWNTIMER_TEST_URL=http://127.0.0.1:1")
+				session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+				Expect(err).ToNot(HaveOccurred())
+				Eventually(session, 5).Should(gexec.Exit(6))
+				Expect(session.Err).To(gbytes.Say("SLO min availability 99.000%: 0.000%, breached"))
+			})
+
+			It("rejects invalid settings before probing", func() {
+				command := exec.Command(binaryPath, "--config", configFile)
+				session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+				Expect(err).ToNot(HaveOccurred())
+				Eventually(session).Should(gexec.Exit(1))
+				Expect(session.Err).To(gbytes.Say("target.url: environment variable DOWNTIMER_TEST_URL is not set"))
+			})
+		})
 	})
 })
@@ -20,7 +20,11 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/jessevdk/go-flags"
@@ -29,58 +33,293 @@ import (
 
 func main() {
 	opts := clients.Opts{}
-	err := ParseArgs(&opts, os.Args)
+	command, commandArgs, err := ParseArgs(&opts, os.Args[1:])
 	if err != nil {
 		log.Println(err)
 		os.Exit(1)
 	}
 
-	var bosh *clients.BoshImpl
+	switch command {
+	case "report":
+		os.Exit(writeReport(&opts, commandArgs))
+	case "compare":
+		os.Exit(compareRecordings(&opts, commandArgs))
+	}
 
+	var bosh *clients.BoshImpl
 	if useBosh(&opts) {
-		bosh, err = clients.GetDirector(opts.BoshHost, 25555, opts.BoshUser, opts.BoshPassword, opts.BoshCACert, opts.LogFile)
-		if err != nil {
-			panic(err)
-		}
-
-		if ok, err := bosh.IsAuthenticated(); !ok {
-			log.Println(err)
-			os.Exit(3)
-		}
+		bosh = connect(&opts)
+	}
+	metrics := serveMetrics(&opts)
 
-		if opts.BoshTask == "" {
-			opts.BoshTask = strconv.Itoa(bosh.WaitForTaskId(180 * time.Second))
-			if opts.BoshTask == "0" {
-				log.Println("Timed out waiting for deployment task")
-				os.Exit(4)
-			}
-		}
+	switch command {
+	case "run":
+		os.Exit(runCommand(&opts, bosh, metrics, commandArgs))
+	case "daemon":
+		log.Println(fmt.Sprintf("Waiting for deployments, probing %s every %s seconds while they run", opts.URL, opts.Interval))
+		stop := make(chan struct{})
+		handleSignals(func(os.Signal) {
+			close(stop)
+		})
+		daemon := clients.NewDaemon(&opts, bosh)
+		daemon.UseMetrics(metrics)
+		daemon.Run(stop)
+		return
 	}
 
 	prober := clients.NewProber(&opts, bosh)
+	prober.UseMetrics(metrics)
+	handleSignals(func(os.Signal) {
+		prober.Stop()
+	})
+
+	if len(opts.Deployments) > 0 {
+		prober.Watch(watchedDeployments(&opts, bosh)...)
+	} else if useBosh(&opts) && opts.BoshTask == "" {
+		opts.BoshTask = strconv.Itoa(prober.RecordBaseline(180 * time.Second))
+		if prober.Stopped() {
+			log.Println("Interrupted while waiting for the deployment task")
+			os.Exit(exitInterrupted)
+		}
+		if opts.BoshTask == "0" {
+			log.Println("Timed out waiting for deployment task")
+			os.Exit(4)
+		}
+	}
 
 	log.Println(fmt.Sprintf("Starting to probe %s every %s seconds", opts.URL, opts.Interval))
-	prober.RecordDowntime()
+	if err := prober.RecordDowntime(); err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
 
-	if useBosh(&opts) {
-		timestamps := bosh.GetDeploymentTimes(opts.BoshTask)
-		log.Println(prober.AnnotateWithTimestamps(timestamps))
+	if exitCode := report(prober, &opts, useBosh(&opts) || len(opts.Deployments) > 0); exitCode != 0 {
+		os.Exit(exitCode)
+	}
+}
+
+// exitInterrupted is the exit code of a shell for a process killed by
+// SIGINT.
+const exitInterrupted = 130
+
+// handleSignals calls stop on the first SIGINT or SIGTERM, so that the
+// recording ends cleanly and is still annotated and summarized. A second
+// signal exits immediately.
+func handleSignals(stop func(os.Signal)) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		received := <-signals
+		log.Println(fmt.Sprintf("Received %s, finishing the recording; repeat to exit immediately", received))
+		stop(received)
+		<-signals
+		log.Println("Exiting without finishing the recording")
+		os.Exit(exitInterrupted)
+	}()
+}
+
+// report annotates the recording with the deployment if there was one, logs
+// the summary and returns the exit code: 5 if a deployment task failed, 6
+// if an SLO was breached.
+func report(prober *clients.Prober, opts *clients.Opts, annotate bool) int {
+	var summary clients.Summary
+	var err error
+	switch {
+	case annotate:
+		summary, err = prober.AnnotateDeployment()
+	case opts.SLOMaxDowntime != 0 || opts.SLOMinAvailability != 0 || opts.SLOMaxP95Latency != 0 || opts.JUnitFile != "":
+		summary, err = prober.Summarize()
+	default:
+		return 0
+	}
+	if err != nil {
+		log.Println(err)
+		return 0
+	}
+	log.Println(summary)
+
+	slos := clients.CheckSLOs(summary, opts)
+	for _, slo := range slos {
+		log.Println(slo)
+	}
+	if err := prober.WriteJUnitReport(summary, slos); err != nil {
+		log.Println(err)
+	}
+	if summary.TaskFailed() {
+		return 5
 	}
+	if !clients.SLOsMet(slos) {
+		return 6
+	}
+	return 0
 }
 
-func ParseArgs(opts *clients.Opts, args []string) error {
-	_, err := flags.ParseArgs(opts, args)
+// connect logs in to the director of the bosh options.
+func connect(opts *clients.Opts) *clients.BoshImpl {
+	host, port, err := clients.SplitBoshHost(opts.BoshHost)
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+	bosh, err := clients.GetDirector(host, port, opts.BoshUser, opts.BoshPassword, opts.BoshCACert, opts.LogFile)
 	if err != nil {
-		return err
+		panic(err)
 	}
 
+	if ok, err := bosh.IsAuthenticated(); !ok {
+		log.Println(err)
+		os.Exit(3)
+	}
+	return bosh
+}
+
+// serveMetrics starts serving Prometheus metrics if --metrics-address is
+// given, and returns nil otherwise.
+func serveMetrics(opts *clients.Opts) *clients.Metrics {
+	if opts.MetricsAddress == "" {
+		return nil
+	}
+	metrics := clients.NewMetrics(opts.OutagePolicy())
+	if err := clients.ServeMetrics(opts.MetricsAddress, metrics); err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+	log.Println(fmt.Sprintf("Serving metrics at http://%s/metrics", opts.MetricsAddress))
+	return metrics
+}
+
+// watchedDeployments connects to the directors of the deployments given as
+// [director/]deployment. Deployments without a director are on the one of
+// the bosh options.
+func watchedDeployments(opts *clients.Opts, bosh *clients.BoshImpl) []*clients.WatchedDeployment {
+	directors := map[string]*clients.BoshImpl{"": bosh}
+	watchers := map[string]*clients.TaskWatcher{"": clients.NewTaskWatcher(bosh, opts)}
+	deployments := []*clients.WatchedDeployment{}
+	for _, spec := range opts.Deployments {
+		director, deployment := clients.ParseDeployment(spec)
+		if _, connected := directors[director]; !connected {
+			directorOpts, err := clients.DirectorOpts(*opts, director, boshConfigPath())
+			if err != nil {
+				log.Println(err)
+				os.Exit(1)
+			}
+			directors[director] = connect(&directorOpts)
+			watchers[director] = clients.NewTaskWatcher(directors[director], opts)
+		}
+		deployments = append(deployments, clients.NewWatchedDeployment(director, deployment, directors[director], watchers[director]))
+	}
+	return deployments
+}
+
+// ParseArgs returns the name and arguments of the command to run, if any.
+func ParseArgs(opts *clients.Opts, args []string) (string, []string, error) {
+	parser := flags.NewParser(opts, flags.Default)
+	parser.SubcommandsOptional = true
+	parser.AddCommand("run",
+		"Record downtime while running a command",
+		"Starts probing, runs the command given after --, e.g. bosh -d cf deploy manifest.yml, and records until it exits. The deployment task is taken from the command's output. Exits with the command's exit code.",
+		&struct{}{})
+	parser.AddCommand("daemon",
+		"Record every deployment on the director",
+		"Watches the director's tasks and records each deployment while its task runs, see --deployment and --output-dir.",
+		&struct{}{})
+	parser.AddCommand("compare",
+		"Compare two recordings",
+		"Compares the downtime, outages, latency and downtime per instance group of an old and a new recording given as arguments, lining them up by the start of their deployments. Exits with code 7 if the downtime increased by more than --max-downtime-increase.",
+		&struct{}{})
+	parser.AddCommand("report",
+		"Turn a recording into an HTML report",
+		"Writes the recording given as argument, with its annotations and summary, to a single HTML file that can be viewed offline, by default named after the recording. Takes the outage options; -u and -i are only needed for recordings without a deployment.",
+		&struct{}{})
+
+	if configFile := configFileArg(args); configFile != "" {
+		configArgs, err := clients.ConfigArgs(configFile, args)
+		if err != nil {
+			return "", nil, err
+		}
+		args = append(configArgs, args...)
+	}
+
+	commandArgs, err := parser.ParseArgs(args)
+	if err != nil {
+		return "", nil, err
+	}
+	// These commands read recordings instead of probing.
+	if parser.Active != nil && parser.Active.Name == "report" {
+		if len(commandArgs) == 0 || len(commandArgs) > 2 {
+			return "", nil, errors.New("report takes a recording and optionally the HTML file to write")
+		}
+		return parser.Active.Name, commandArgs, nil
+	}
+	if parser.Active != nil && parser.Active.Name == "compare" {
+		if len(commandArgs) != 2 {
+			return "", nil, errors.New("compare takes the old and the new recording")
+		}
+		return parser.Active.Name, commandArgs, nil
+	}
+	if err := opts.Validate(); err != nil {
+		return "", nil, err
+	}
+
+	opts.ReadBoshEnv()
+	if err := clients.ResolveBoshOpts(opts, boshConfigPath()); err != nil {
+		return "", nil, err
+	}
 	if useBosh(opts) {
 		if opts.BoshHost == "" || opts.BoshUser == "" || opts.BoshPassword == "" || opts.BoshCACert == "" {
-			return errors.New("all bosh options must be specified")
+			return "", nil, errors.New("all bosh options must be specified")
+		}
+	}
+
+	daemon := parser.Active != nil && parser.Active.Name == "daemon"
+	for _, deployment := range opts.Deployments {
+		director, _ := clients.ParseDeployment(deployment)
+		if director != "" && daemon {
+			return "", nil, errors.New("daemon mode records the deployments of a single director")
+		}
+		if director == "" && !daemon && !useBosh(opts) {
+			return "", nil, fmt.Errorf("deployment %s requires the bosh options or a director", deployment)
+		}
+	}
+
+	if parser.Active == nil {
+		return "", nil, nil
+	}
+	switch parser.Active.Name {
+	case "run":
+		if len(commandArgs) == 0 {
+			return "", nil, errors.New("no command given to run")
+		}
+	case "daemon":
+		if !useBosh(opts) {
+			return "", nil, errors.New("daemon mode requires the bosh options")
+		}
+	}
+	return parser.Active.Name, commandArgs, nil
+}
+
+// configFileArg finds the --config file ahead of parsing, as its settings
+// are parsed along with the command line.
+func configFileArg(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if strings.HasPrefix(arg, "--config=") {
+			return strings.TrimPrefix(arg, "--config=")
+		}
+		if arg == "--config" && i+1 < len(args) {
+			return args[i+1]
 		}
 	}
+	return ""
+}
 
-	return nil
+func boshConfigPath() string {
+	if path := os.Getenv("BOSH_CONFIG"); path != "" {
+		return path
+	}
+	return filepath.Join(os.Getenv("HOME"), ".bosh", "config")
 }
 
 func useBosh(opts *clients.Opts) bool {
@@ -0,0 +1,67 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/pivotal-cf/downtimer/clients"
+)
+
+// writeReport turns the recording given as first argument into an HTML
+// report, written to the second argument or next to the recording.
+func writeReport(opts *clients.Opts, args []string) int {
+	recording := args[0]
+	output := strings.TrimSuffix(recording, filepath.Ext(recording)) + ".html"
+	if len(args) > 1 {
+		output = args[1]
+	}
+	if err := clients.WriteHTMLReport(recording, output, opts); err != nil {
+		log.Println(err)
+		return 1
+	}
+	log.Println(fmt.Sprintf("Wrote the report of %s to %s", recording, output))
+	return 0
+}
+
+// exitWorse is the exit code of compare if the new recording had too much
+// more downtime than the old one.
+const exitWorse = 7
+
+// compareRecordings prints how the second recording given differs from the
+// first.
+func compareRecordings(opts *clients.Opts, args []string) int {
+	before, err := clients.NewReport(args[0], opts)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	after, err := clients.NewReport(args[1], opts)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	comparison := clients.Compare(before, after)
+	fmt.Println(comparison)
+	if opts.CompareThreshold != 0 && comparison.DowntimeIncrease() > opts.CompareThreshold {
+		log.Println(fmt.Sprintf("The downtime increased by %s, more than %s", comparison.DowntimeIncrease(), opts.CompareThreshold))
+		return exitWorse
+	}
+	return 0
+}
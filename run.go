@@ -0,0 +1,176 @@
+/* Copyright (C) 2017-Present Pivotal Software, Inc. All rights reserved.
+
+This program and the accompanying materials are made available under
+the terms of the under the Apache License, Version 2.0 (the "License”);
+you may not use this file except in compliance with the License.
+
+You may obtain a copy of the License at
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pivotal-cf/downtimer/clients"
+)
+
+var taskLine = regexp.MustCompile(`^Task (\d+)`)
+
+// runCommand records downtime for as long as the given command, typically a
+// bosh deploy, runs. Its output goes to stderr to keep it apart from CSV rows
+// written to stdout.
+func runCommand(opts *clients.Opts, bosh *clients.BoshImpl, metrics *clients.Metrics, args []string) int {
+	prober := clients.NewProber(opts, bosh)
+	prober.UseMetrics(metrics)
+	recorded := make(chan error)
+	log.Println(fmt.Sprintf("Starting to probe %s every %s seconds", opts.URL, opts.Interval))
+	go func() {
+		recorded <- prober.RecordDowntime()
+	}()
+
+	reader, writer := io.Pipe()
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = io.MultiWriter(os.Stderr, writer)
+	cmd.Stderr = os.Stderr
+
+	taskIDs := make(chan string, 2)
+	go scanForTaskID(reader, taskIDs)
+
+	// The recording ends when the command exits, so pass signals on to it
+	// once it runs. Before, they end the baseline and the command isn't run.
+	var lock sync.Mutex
+	started := false
+	interrupted := make(chan struct{})
+	handleSignals(func(received os.Signal) {
+		lock.Lock()
+		defer lock.Unlock()
+		if started {
+			cmd.Process.Signal(received)
+			return
+		}
+		close(interrupted)
+	})
+
+	if opts.Baseline != 0 {
+		log.Println(fmt.Sprintf("Recording a baseline for %s", opts.Baseline))
+		select {
+		case <-time.After(opts.Baseline):
+		case <-interrupted:
+		}
+	}
+	lock.Lock()
+	select {
+	case <-interrupted:
+		lock.Unlock()
+		log.Println("Interrupted before running the command")
+		prober.Stop()
+		if err := <-recorded; err != nil {
+			log.Println(err)
+		}
+		report(prober, opts, false)
+		return exitInterrupted
+	default:
+	}
+	prober.MarkDeployStart()
+	err := cmd.Start()
+	started = err == nil
+	lock.Unlock()
+	if err != nil {
+		log.Println(err)
+		prober.Stop()
+		<-recorded
+		return 1
+	}
+
+	if useBosh(opts) && opts.BoshTask == "" {
+		go func() {
+			if id := prober.WaitForTask(180 * time.Second); id != 0 {
+				taskIDs <- strconv.Itoa(id)
+			}
+		}()
+	}
+
+	exitCode := exitStatus(cmd.Wait())
+	writer.Close()
+	prober.MarkDeployEnd()
+	if opts.Tail != 0 {
+		log.Println(fmt.Sprintf("Command exited, probing for another %s", opts.Tail))
+		time.Sleep(opts.Tail)
+	}
+	prober.Stop()
+	if err := <-recorded; err != nil {
+		log.Println(err)
+	}
+
+	annotate := false
+	if useBosh(opts) {
+		if opts.BoshTask == "" {
+			select {
+			case opts.BoshTask = <-taskIDs:
+			default:
+			}
+		}
+		if opts.BoshTask == "" {
+			log.Println("Could not find the deployment task, skipping annotations")
+		} else {
+			annotate = true
+		}
+	}
+	if reportExitCode := report(prober, opts, annotate); exitCode == 0 {
+		exitCode = reportExitCode
+	}
+	return exitCode
+}
+
+func scanForTaskID(reader io.Reader, taskIDs chan<- string) {
+	found := false
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		if found {
+			continue
+		}
+		if match := taskLine.FindStringSubmatch(scanner.Text()); match != nil {
+			taskIDs <- match[1]
+			found = true
+		}
+	}
+	// Keep draining so the command never blocks on its output.
+	io.Copy(ioutil.Discard, reader)
+}
+
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			// Like a shell, report a command killed by a signal as
+			// 128 plus the signal.
+			if status.Signaled() {
+				return 128 + int(status.Signal())
+			}
+			return status.ExitStatus()
+		}
+	}
+	log.Println(err)
+	return 1
+}